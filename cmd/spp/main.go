@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"net/url"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
+	// Schedules can be in any time zone, even if the host doesn't have tzdata installed
+	_ "time/tzdata"
 
 	env "github.com/joho/godotenv"
 	"github.com/thatliuser/simipangpang/pkg/discord"
@@ -16,6 +21,28 @@ func interruptCtx() (context.Context, context.CancelFunc) {
 	return signal.NotifyContext(context.Background(), os.Interrupt)
 }
 
+// Rereads the .env file and the Riot API key on SIGHUP
+func reloadOnHangup(ctx context.Context, client *riot.Client) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	for {
+		select {
+		case <-hangup:
+			if err := env.Overload(); err != nil {
+				log.Printf("Couldn't reload dotenv file: %v", err)
+			}
+			if err := client.ReloadKey(); err != nil {
+				log.Printf("Couldn't reload Riot API key: %v", err)
+			} else {
+				log.Printf("Reloaded Riot API key")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 func main() {
 	ctx, cancel := interruptCtx()
 	defer cancel()
@@ -23,7 +50,48 @@ func main() {
 	if err := env.Load(); err != nil {
 		log.Fatalf("Couldn't load dotenv file: %v", err)
 	}
-	riot, err := riot.New(time.Second * 10)
+	mode := flag.String("riot-mode", os.Getenv("RIOT_MODE"), "Where Riot responses come from (live, record or replay)")
+	fixtures := flag.String("riot-fixtures", riot.DefaultFixtureDir, "Directory to record Riot responses to or replay them from")
+	baseURL := flag.String("riot-base-url", os.Getenv("RIOT_BASE_URL"), "Send Riot requests somewhere else, like a mock API")
+	cache := flag.String("riot-cache", os.Getenv("RIOT_CACHE"), "Where to cache Riot responses (none, memory or redis)")
+	redisURL := flag.String("redis-url", os.Getenv("REDIS_URL"), "Redis instance to use for the Riot cache")
+	cacheTTLs := flag.String("riot-cache-ttls", os.Getenv("RIOT_CACHE_TTLS"), "Per-endpoint cache TTLs, like match=24h,league=1m")
+	flag.Parse()
+	riotMode, err := riot.ParseMode(*mode)
+	if err != nil {
+		log.Fatalf("Couldn't parse Riot mode: %v", err)
+	}
+	riotOpts := []riot.Option{riot.WithMode(riotMode, *fixtures)}
+	if *baseURL != "" {
+		u, err := url.Parse(*baseURL)
+		if err != nil {
+			log.Fatalf("Couldn't parse Riot base URL: %v", err)
+		}
+		riotOpts = append(riotOpts, riot.WithBaseURL(u))
+	}
+	ttls, err := riot.ParseCacheTTLs(*cacheTTLs)
+	if err != nil {
+		log.Fatalf("Couldn't parse Riot cache TTLs: %v", err)
+	}
+	switch *cache {
+	case "", "none":
+	case "memory":
+		store, err := riot.NewMemoryCache(ctx, ttls)
+		if err != nil {
+			log.Fatalf("Couldn't create Riot cache: %v", err)
+		}
+		riotOpts = append(riotOpts, riot.WithCache(store, ttls))
+	case "redis":
+		store, err := riot.NewRedisCache(ctx, *redisURL)
+		if err != nil {
+			log.Fatalf("Couldn't create Riot cache: %v", err)
+		}
+		riotOpts = append(riotOpts, riot.WithCache(store, ttls))
+	default:
+		log.Fatalf("Riot cache not recognized: %v", *cache)
+	}
+
+	riot, err := riot.New(time.Second*10, riotOpts...)
 	if err != nil {
 		log.Fatalf("Couldn't create Riot client: %v", err)
 	}
@@ -32,6 +100,15 @@ func main() {
 		log.Fatalf("Couldn't create Discord bot: %v", err)
 	}
 	defer bot.Save()
+	riot.OnKeyRejected(bot.RiotKeyRejected)
+	go riot.WatchKeyFile(ctx, func(err error) {
+		if err != nil {
+			log.Printf("Couldn't reload Riot API key from token file: %v", err)
+		} else {
+			log.Printf("Reloaded Riot API key from token file")
+		}
+	})
+	go reloadOnHangup(ctx, riot)
 
 	if err := bot.Run(ctx); err != nil {
 		log.Fatalf("Couldn't run Discord bot: %v", err)
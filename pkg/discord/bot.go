@@ -9,16 +9,28 @@ import (
 	"io"
 	"log"
 	"os"
+	"time"
 
 	discord "github.com/bwmarrin/discordgo"
 	"github.com/thatliuser/simipangpang/pkg/riot"
 )
 
 type Bot struct {
-	session *discord.Session
-	client  *riot.Client
-	log     *log.Logger
-	servers map[string]*Server
+	session  *discord.Session
+	client   riot.Provider
+	log      *log.Logger
+	servers  *serverRegistry
+	calendar *riot.Calendar
+	tracked  trackedAccounts
+	// Only in memory, since it's just a fallback
+	snapshots snapshots
+	shared    sharedCalls
+	// User ID that gets alerts and can run owner commands
+	owner string
+	// Weekly LP baselines
+	ladder ladder
+	// Updates, recaps and anything else on a timer
+	jobs *jobs
 }
 
 const (
@@ -32,10 +44,16 @@ func (b *Bot) Load() error {
 	}
 	for _, id := range ids {
 		server, err := ServerFromFile(b, b.log.Writer(), id)
-		if err != nil {
+		if err != nil && b.guildGone(id) {
+			// Got removed while the bot was down, so don't keep trying to load it every time
+			b.log.Printf("No longer in guild %v, archiving its settings", id)
+			if err := archiveServer(id); err != nil {
+				b.log.Printf("Couldn't archive server %v: %v", id, err)
+			}
+		} else if err != nil {
 			b.log.Printf("Couldn't load server with ID %v: %v", id, err)
 		} else {
-			b.servers[id] = server
+			b.servers.add(id, server)
 		}
 	}
 
@@ -43,29 +61,54 @@ func (b *Bot) Load() error {
 }
 
 func (b *Bot) Save() {
-	for id, server := range b.servers {
+	if err := b.saveTracked(); err != nil {
+		b.log.Printf("Failed to save tracked accounts: %v", err)
+	}
+	if err := b.saveLadder(); err != nil {
+		b.log.Printf("Failed to save ladder: %v", err)
+	}
+	for id, server := range b.servers.all() {
 		if err := server.Save(); err != nil {
 			b.log.Printf("Failed to save server with ID %v: %v", id, err)
 		}
 	}
 }
 
-func New(client *riot.Client, output io.Writer) (*Bot, error) {
+// Doesn't connect to anything or load any state. Nothing that builds embeds touches the session,
+// so they work on a bot made with a nil one, which is how the tests use it.
+func newBot(session *discord.Session, client riot.Provider, calendar *riot.Calendar, output io.Writer) *Bot {
+	b := &Bot{
+		session:  session,
+		client:   client,
+		log:      log.New(output, "discord.Bot: ", log.Ldate|log.Ltime),
+		servers:  newServerRegistry(),
+		calendar: calendar,
+	}
+	b.jobs = newJobs(b.log)
+	return b
+}
+
+func New(client riot.Provider, output io.Writer) (*Bot, error) {
 	token, ok := os.LookupEnv(tokenEnv)
 	if !ok {
 		return nil, fmt.Errorf("couldn't lookup token for discord bot (%v) in environment", tokenEnv)
 	}
+	calendar, err := riot.LoadCalendar()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load season calendar: %v", err)
+	}
 	session, err := discord.New(fmt.Sprintf("Bot %v", token))
 	if err != nil {
 		return nil, fmt.Errorf("couldn't create discord session: %v", err)
 	}
-	b := &Bot{
-		session: (session),
-		client:  client,
-		log:     log.New(output, "discord.Bot: ", log.Ldate|log.Ltime),
-		servers: make(map[string]*Server),
+	b := newBot(session, client, calendar, output)
+	b.session.Identify.Intents = discord.IntentMessageContent | discord.IntentGuildMessages | discord.IntentGuilds
+	if err := b.loadTracked(); err != nil {
+		return nil, fmt.Errorf("couldn't load tracked accounts: %v", err)
+	}
+	if err := b.loadLadder(); err != nil {
+		return nil, fmt.Errorf("couldn't load ladder: %v", err)
 	}
-	b.session.Identify.Intents = discord.IntentMessageContent | discord.IntentGuildMessages
 	if err := b.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return nil, fmt.Errorf("couldn't load savefile: %v", err)
 	}
@@ -73,15 +116,20 @@ func New(client *riot.Client, output io.Writer) (*Bot, error) {
 }
 
 func (b *Bot) Run(ctx context.Context) error {
+	b.addGuildListeners()
 	if err := b.session.Open(); err != nil {
 		return fmt.Errorf("couldn't open discord session: %v", err)
 	}
 	defer b.session.Close()
+	b.lookupOwner()
 	if err := b.addListeners(); err != nil {
 		return fmt.Errorf("couldn't add slash commands: %v", err)
 	}
 	defer b.Stop()
 
+	b.scheduleRecap()
+	go b.jobs.Run(ctx)
+
 	b.log.Println("Discord bot up!")
 
 	// Wait for context to expire
@@ -90,9 +138,22 @@ func (b *Bot) Run(ctx context.Context) error {
 	return nil
 }
 
+// Posts a recap to every update channel when the current split ends, then does it again for the next one
+func (b *Bot) scheduleRecap() {
+	split := b.calendar.NextEnd(time.Now())
+	if split == nil {
+		b.log.Println("No more splits in the season calendar, stopping split recaps")
+		return
+	}
+	b.jobs.Schedule("recap", "", split.End, func() {
+		b.SplitRecap(split)
+		b.scheduleRecap()
+	})
+}
+
 func (b *Bot) Stop() {
 	b.log.Println("Stopping all servers")
-	for _, server := range b.servers {
+	for _, server := range b.servers.all() {
 		server.Stop()
 	}
 }
@@ -5,12 +5,30 @@ package discord
 import (
 	"fmt"
 	"slices"
+	"strings"
 	"time"
 
+	"github.com/Kyagara/equinox/clients/ddragon"
 	discord "github.com/bwmarrin/discordgo"
 	"github.com/thatliuser/simipangpang/pkg/riot"
 )
 
+// 1 -> 1st, 2 -> 2nd, etc.
+func ordinal(n int32) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+		// 11th, 12th, 13th are special
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return fmt.Sprintf("%v%v", n, suffix)
+}
+
 func (b *Bot) emptyMatch(account *riot.Account, caption string) ([]*discord.MessageEmbed, error) {
 	return []*discord.MessageEmbed{
 		{
@@ -27,7 +45,7 @@ func (b *Bot) emptyMatch(account *riot.Account, caption string) ([]*discord.Mess
 	}, nil
 }
 
-func (b *Bot) matchEmbed(account *riot.Account, match *riot.Match, caption string) ([]*discord.MessageEmbed, error) {
+func (b *Bot) matchEmbed(account *riot.Account, match *riot.Match, caption string, lang ddragon.Language) ([]*discord.MessageEmbed, error) {
 	colorForWin := func(match *riot.Match) int {
 		if match.Won {
 			// Green-ish
@@ -41,6 +59,9 @@ func (b *Bot) matchEmbed(account *riot.Account, match *riot.Match, caption strin
 		if match == nil {
 			return "No matches found"
 		}
+		if match.Queue.HasPlacements() {
+			return fmt.Sprintf("**%v place** (played <t:%v:R>)", ordinal(match.Placement), match.Time.Unix())
+		}
 		won := ""
 		if match.Won {
 			won = "Victory"
@@ -49,11 +70,76 @@ func (b *Bot) matchEmbed(account *riot.Account, match *riot.Match, caption strin
 		}
 		return fmt.Sprintf("**%v** (played <t:%v:R>)", won, match.Time.Unix())
 	}
-	champ, err := b.client.ChampionByID(int(match.Champ))
+	champ, err := b.client.ChampionByID(int(match.Champ), lang)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't create match stats: %v", err)
 	}
 	champURL := b.client.IconURLForChamp(champ)
+
+	// Missing metadata shouldn't stop the whole embed from showing up, so these just get skipped
+	build := []string{}
+	for _, id := range match.Items {
+		if item, err := b.client.Item(int(id), lang); err == nil {
+			build = append(build, item.Name)
+		} else {
+			b.log.Printf("Couldn't lookup item for match stats: %v", err)
+		}
+	}
+	spells := []string{}
+	for _, id := range match.Spells {
+		if spell, err := b.client.SummonerSpell(int(id), lang); err == nil {
+			spells = append(spells, spell.Name)
+		} else {
+			b.log.Printf("Couldn't lookup summoner spell for match stats: %v", err)
+		}
+	}
+	footer := &discord.MessageEmbedFooter{
+		Text: caption,
+	}
+	fields := []*discord.MessageEmbedField{
+		{
+			Name:   "Kills",
+			Value:  fmt.Sprint(match.Kills),
+			Inline: true,
+		},
+		{
+			Name:   "Deaths",
+			Value:  fmt.Sprint(match.Deaths),
+			Inline: true,
+		},
+		{
+			Name:   "Assists",
+			Value:  fmt.Sprint(match.Assists),
+			Inline: true,
+		},
+	}
+	if match.Keystone != 0 {
+		if keystone, err := b.client.Rune(int(match.Keystone), lang); err == nil {
+			fields = append(fields, &discord.MessageEmbedField{
+				Name:   "Keystone",
+				Value:  keystone.Name,
+				Inline: true,
+			})
+			footer.IconURL = b.client.IconURLForRune(keystone)
+		} else {
+			b.log.Printf("Couldn't lookup keystone for match stats: %v", err)
+		}
+	}
+	if len(spells) > 0 {
+		fields = append(fields, &discord.MessageEmbedField{
+			Name:   "Spells",
+			Value:  strings.Join(spells, ", "),
+			Inline: true,
+		})
+	}
+	if len(build) > 0 {
+		fields = append(fields, &discord.MessageEmbedField{
+			Name:   "Build",
+			Value:  strings.Join(build, ", "),
+			Inline: false,
+		})
+	}
+
 	return []*discord.MessageEmbed{
 		{
 			Color: colorForWin(match),
@@ -65,54 +151,36 @@ func (b *Bot) matchEmbed(account *riot.Account, match *riot.Match, caption strin
 				URL: champURL,
 			},
 			Description: descForMatch(match),
-			Footer: &discord.MessageEmbedFooter{
-				Text: caption,
-			},
-			Fields: []*discord.MessageEmbedField{
-				{
-					Name:   "Kills",
-					Value:  fmt.Sprint(match.Kills),
-					Inline: true,
-				},
-				{
-					Name:   "Deaths",
-					Value:  fmt.Sprint(match.Deaths),
-					Inline: true,
-				},
-				{
-					Name:   "Assists",
-					Value:  fmt.Sprint(match.Assists),
-					Inline: true,
-				},
-			},
+			Footer:      footer,
+			Fields:      fields,
 		},
 	}, nil
 }
 
 // Assumes matches are sorted by performance
-func (b *Bot) bestMatchEmbed(account *riot.Account, matches []*riot.Match) ([]*discord.MessageEmbed, error) {
-	caption := "Best match this week"
+func (b *Bot) bestMatchEmbed(account *riot.Account, matches []*riot.Match, desc string, lang ddragon.Language) ([]*discord.MessageEmbed, error) {
+	caption := fmt.Sprintf("Best %v", desc)
 	if len(matches) < 1 {
 		return b.emptyMatch(account, caption)
 	}
 
 	bestMatch := matches[len(matches)-1]
-	return b.matchEmbed(account, bestMatch, caption)
+	return b.matchEmbed(account, bestMatch, caption, lang)
 }
 
 // Assumes matches are sorted by performance
-func (b *Bot) worstMatchEmbed(account *riot.Account, matches []*riot.Match) ([]*discord.MessageEmbed, error) {
-	caption := "Worst match this week"
+func (b *Bot) worstMatchEmbed(account *riot.Account, matches []*riot.Match, desc string, lang ddragon.Language) ([]*discord.MessageEmbed, error) {
+	caption := fmt.Sprintf("Worst %v", desc)
 	if len(matches) < 1 {
 		return b.emptyMatch(account, caption)
 	}
 
 	worstMatch := matches[0]
-	return b.matchEmbed(account, worstMatch, caption)
+	return b.matchEmbed(account, worstMatch, caption, lang)
 }
 
-func (b *Bot) matchesByPerformance(account *riot.Account) ([]*riot.Match, error) {
-	matches, err := b.client.RankedMatchesSince(account, time.Now().AddDate(0, 0, -7))
+func (b *Bot) matchesByPerformance(account *riot.Account, queue riot.Queue, since time.Time, lk *lookup) ([]*riot.Match, error) {
+	matches, err := b.matchesOrSnapshot(account, queue, since, lk)
 	if err != nil {
 		return nil, err
 	} else {
@@ -121,17 +189,77 @@ func (b *Bot) matchesByPerformance(account *riot.Account) ([]*riot.Match, error)
 	}
 }
 
-func (b *Bot) shortEmbed(account *riot.Account) ([]*discord.MessageEmbed, error) {
-	top, err := b.client.TopChampionsByMastery(account, 1)
+func (b *Bot) shortEmbed(account *riot.Account, lang ddragon.Language, lk *lookup) ([]*discord.MessageEmbed, error) {
+	top, err := b.topMasteryOrSnapshot(account, lk)
 	if err != nil {
 		return nil, err
 	}
-	mastery := top[0]
-	champ, err := b.client.ChampionByID(int(mastery.ChampionID))
-	if err != nil {
-		return nil, err
+	fields := []*discord.MessageEmbedField{
+		{
+			Name:   "Wins",
+			Value:  fmt.Sprint(account.Wins),
+			Inline: true,
+		},
+		{
+			Name:   "Losses",
+			Value:  fmt.Sprint(account.Losses),
+			Inline: true,
+		},
+		{
+			Name:   "Winrate",
+			Value:  fmt.Sprintf("%v%%", int(account.Winrate())),
+			Inline: true,
+		},
+	}
+	// New accounts might not have played anything yet
+	image := (*discord.MessageEmbedImage)(nil)
+	if len(top) > 0 {
+		mastery := top[0]
+		champ, err := b.client.ChampionByID(int(mastery.ChampionID), lang)
+		if err != nil {
+			return nil, err
+		}
+		image = &discord.MessageEmbedImage{
+			URL: b.client.IconURLForChamp(champ),
+		}
+		fields = append(fields,
+			&discord.MessageEmbedField{
+				Name:   "Top mastery",
+				Value:  champ.Name,
+				Inline: true,
+			},
+			&discord.MessageEmbedField{
+				Name:   "Mastery points",
+				Value:  fmt.Sprint(mastery.ChampionPoints),
+				Inline: true,
+			},
+		)
+	}
+	if tracked, ok := b.trackedByPUUID(account.PUUID); ok && len(tracked.History) > 0 {
+		names := []string{}
+		// Most recent first
+		for i := len(tracked.History) - 1; i >= 0; i-- {
+			change := tracked.History[i]
+			names = append(names, fmt.Sprintf("%v#%v (until <t:%v:d>)", change.Name, change.Discrim, change.Until.Unix()))
+		}
+		fields = append(fields, &discord.MessageEmbedField{
+			Name:   "Previously known as",
+			Value:  strings.Join(names, "\n"),
+			Inline: false,
+		})
+	}
+
+	thumbnail := (*discord.MessageEmbedThumbnail)(nil)
+	desc := fmt.Sprintf("**%v**\n", account.Rank)
+	if account.Ranked() {
+		thumbnail = &discord.MessageEmbedThumbnail{
+			URL: account.RankURL,
+		}
+		desc = fmt.Sprintf(
+			"**%v** / %v LP\n",
+			account.Rank, account.Points,
+		)
 	}
-	champURL := b.client.IconURLForChamp(champ)
 
 	return []*discord.MessageEmbed{
 		{
@@ -140,60 +268,27 @@ func (b *Bot) shortEmbed(account *riot.Account) ([]*discord.MessageEmbed, error)
 				Name:    fmt.Sprintf("%v#%v", account.Name, account.Discrim),
 				IconURL: account.IconURL,
 			},
-			Thumbnail: &discord.MessageEmbedThumbnail{
-				URL: account.RankURL,
-			},
-			Description: fmt.Sprintf(
-				"**%v** / %v LP\n",
-				account.Rank, account.Points,
-			),
+			Thumbnail:   thumbnail,
+			Description: desc,
 			Footer: &discord.MessageEmbedFooter{
 				Text: "Account stats",
 			},
-			Image: &discord.MessageEmbedImage{
-				URL: champURL,
-			},
-			Fields: []*discord.MessageEmbedField{
-				{
-					Name:   "Wins",
-					Value:  fmt.Sprint(account.Wins),
-					Inline: true,
-				},
-				{
-					Name:   "Losses",
-					Value:  fmt.Sprint(account.Losses),
-					Inline: true,
-				},
-				{
-					Name:   "Winrate",
-					Value:  fmt.Sprintf("%v%%", int(account.Winrate())),
-					Inline: true,
-				},
-				{
-					Name:   "Top mastery",
-					Value:  champ.Name,
-					Inline: true,
-				},
-				{
-					Name:   "Mastery points",
-					Value:  fmt.Sprint(mastery.ChampionPoints),
-					Inline: true,
-				},
-			},
+			Image:  image,
+			Fields: fields,
 		},
 	}, nil
 }
 
-func (b *Bot) allEmbed(account *riot.Account, matches []*riot.Match) ([]*discord.MessageEmbed, error) {
-	bestMatch, err := b.bestMatchEmbed(account, matches)
+func (b *Bot) allEmbed(account *riot.Account, matches []*riot.Match, desc string, lang ddragon.Language, lk *lookup) ([]*discord.MessageEmbed, error) {
+	bestMatch, err := b.bestMatchEmbed(account, matches, desc, lang)
 	if err != nil {
 		return nil, err
 	}
-	worstMatch, err := b.worstMatchEmbed(account, matches)
+	worstMatch, err := b.worstMatchEmbed(account, matches, desc, lang)
 	if err != nil {
 		return nil, err
 	}
-	short, err := b.shortEmbed(account)
+	short, err := b.shortEmbed(account, lang, lk)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,313 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Kyagara/equinox/clients/ddragon"
+	"github.com/Kyagara/equinox/clients/lol"
+	equinoxriot "github.com/Kyagara/equinox/clients/riot"
+	"github.com/thatliuser/simipangpang/pkg/riot"
+	"github.com/thatliuser/simipangpang/pkg/riot/riotfake"
+	"github.com/thatliuser/simipangpang/pkg/riot/riottest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata instead of checking against them")
+
+// Everything the sample matches happened in the week before this
+var sampleNow = time.Date(2024, 3, 10, 20, 0, 0, 0, time.UTC)
+
+const (
+	samplePUUID   = "puuid-simi"
+	unrankedPUUID = "puuid-newbie"
+	// Hasn't played a game yet, so no mastery either
+	freshPUUID = "puuid-fresh"
+)
+
+func sampleClient() *riotfake.Client {
+	c := riotfake.New()
+	c.Accounts[samplePUUID] = &riot.Account{
+		Name:     "simipangpang",
+		Discrim:  "NA1",
+		PUUID:    samplePUUID,
+		IconID:   4568,
+		IconURL:  c.IconURLForProfileIcon(4568),
+		Rank:     "Gold II",
+		RankURL:  "https://example.com/rank/gold.png",
+		Tier:     "GOLD",
+		Division: "II",
+		Wins:     30,
+		Losses:   20,
+		Points:   45,
+	}
+	c.Accounts[unrankedPUUID] = &riot.Account{
+		Name:    "newbie",
+		Discrim: "NA1",
+		PUUID:   unrankedPUUID,
+		IconID:  29,
+		IconURL: c.IconURLForProfileIcon(29),
+		Rank:    "Unranked",
+	}
+	c.Accounts[freshPUUID] = &riot.Account{
+		Name:    "fresh",
+		Discrim: "NA1",
+		PUUID:   freshPUUID,
+		IconID:  29,
+		IconURL: c.IconURLForProfileIcon(29),
+		Rank:    "Unranked",
+	}
+	c.Masteries[samplePUUID] = []lol.ChampionMasteryV4DTO{
+		{ChampionID: 222, ChampionPoints: 12000},
+		{ChampionID: 103, ChampionPoints: 250000},
+	}
+	c.Masteries[unrankedPUUID] = []lol.ChampionMasteryV4DTO{
+		{ChampionID: 222, ChampionPoints: 900},
+	}
+	c.Champions = []ddragon.FullChampion{
+		{ID: "Ahri", Key: "103", Name: "Ahri"},
+		{ID: "Jinx", Key: "222", Name: "Jinx"},
+	}
+	c.Items[3089] = riot.Item{ID: 3089, Name: "Rabadon's Deathcap", Image: "3089.png"}
+	c.Items[3020] = riot.Item{ID: 3020, Name: "Sorcerer's Shoes", Image: "3020.png"}
+	c.Items[3031] = riot.Item{ID: 3031, Name: "Infinity Edge", Image: "3031.png"}
+	c.Runes[8112] = riot.Rune{ID: 8112, Name: "Electrocute", Icon: "perk-images/Styles/Domination/Electrocute/Electrocute.png"}
+	c.Runes[8008] = riot.Rune{ID: 8008, Name: "Lethal Tempo", Icon: "perk-images/Styles/Precision/LethalTempo/LethalTempoTemp.png"}
+	c.Spells[4] = riot.SummonerSpell{ID: 4, Name: "Flash", Image: "SummonerFlash.png"}
+	c.Spells[14] = riot.SummonerSpell{ID: 14, Name: "Ignite", Image: "SummonerDot.png"}
+	c.Spells[32] = riot.SummonerSpell{ID: 32, Name: "Mark", Image: "SummonerSnowball.png"}
+
+	ago := func(hours int) time.Time { return sampleNow.Add(-time.Duration(hours) * time.Hour) }
+	c.Matches[samplePUUID] = []*riot.Match{
+		{ID: "NA1_1", Kills: 10, Deaths: 2, Assists: 8, Won: true, Champ: 103, Time: ago(5), Queue: riot.QueueRanked,
+			Items: []int32{3089, 3020}, Keystone: 8112, Spells: []int32{4, 14}},
+		{ID: "NA1_2", Kills: 2, Deaths: 7, Assists: 3, Won: false, Champ: 222, Time: ago(30), Queue: riot.QueueRanked,
+			Items: []int32{3031}, Keystone: 8008, Spells: []int32{4, 14}},
+		{ID: "NA1_3", Kills: 5, Deaths: 5, Assists: 5, Won: true, Champ: 222, Time: ago(50), Queue: riot.QueueRanked,
+			Items: []int32{3031}, Keystone: 8008, Spells: []int32{4, 14}},
+		// Old enough to be left out
+		{ID: "NA1_4", Kills: 30, Deaths: 0, Assists: 0, Won: true, Champ: 103, Time: ago(24 * 10), Queue: riot.QueueRanked},
+		{ID: "NA1_5", Kills: 15, Deaths: 9, Assists: 30, Won: true, Champ: 222, Time: ago(10), Queue: riot.QueueARAM,
+			Items: []int32{3031}, Spells: []int32{4, 32}},
+		{ID: "NA1_6", Kills: 4, Deaths: 12, Assists: 20, Won: false, Champ: 103, Time: ago(11), Queue: riot.QueueARAM,
+			Items: []int32{3089}, Spells: []int32{4, 32}},
+		// Placements beat kills in Arena
+		{ID: "NA1_7", Kills: 3, Deaths: 4, Assists: 9, Won: true, Champ: 103, Time: ago(20), Queue: riot.QueueArena, Placement: 1,
+			Items: []int32{3089}},
+		{ID: "NA1_8", Kills: 12, Deaths: 5, Assists: 2, Won: false, Champ: 222, Time: ago(21), Queue: riot.QueueArena, Placement: 6,
+			Items: []int32{3031}},
+	}
+	c.TFTRanks[samplePUUID] = &riot.TFTRank{
+		Rank:    "Silver III",
+		RankURL: "https://example.com/rank/silver.png",
+		Tier:    "SILVER",
+		Wins:    12,
+		Losses:  8,
+		Points:  10,
+	}
+	c.TFTMatches[samplePUUID] = []*riot.TFTMatch{
+		{Placement: 2, Level: 8, Traits: []string{"KDA", "Pentakill"}, Units: []string{"Ahri", "Akali", "Karthus"}, Time: ago(4)},
+		{Placement: 6, Level: 7, Traits: []string{"KDA"}, Units: []string{"Ahri", "Evelynn"}, Time: ago(20)},
+		{Placement: 1, Level: 9, Traits: []string{"Pentakill"}, Units: []string{"Karthus"}, Time: ago(24 * 10)},
+	}
+	return c
+}
+
+func checkGolden(t *testing.T, name string, got any) {
+	t.Helper()
+	// Mentions and timestamps are a lot easier to read without < and > escaped
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(got); err != nil {
+		t.Fatal(err)
+	}
+	contents := buf.Bytes()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("couldn't read golden file (run with -update to make it): %v", err)
+	}
+	if !bytes.Equal(contents, want) {
+		t.Errorf("embeds for %v don't match %v (run with -update if this is on purpose)\ngot:\n%s", name, path, contents)
+	}
+}
+
+func TestEmbedsGolden(t *testing.T) {
+	// The golden files live next to the test, but the bot saves to a temp dir
+	pkgDir, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name  string
+		puuid string
+		verb  string
+		queue riot.Queue
+	}{
+		{"ranked_all", samplePUUID, "all", riot.QueueRanked},
+		{"ranked_best", samplePUUID, "best", riot.QueueRanked},
+		{"ranked_worst", samplePUUID, "worst", riot.QueueRanked},
+		{"aram_all", samplePUUID, "all", riot.QueueARAM},
+		{"arena_all", samplePUUID, "all", riot.QueueArena},
+		{"short", samplePUUID, "short", riot.QueueRanked},
+		{"empty_history", unrankedPUUID, "all", riot.QueueRanked},
+		{"no_mastery", freshPUUID, "short", riot.QueueRanked},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b := newTestBot(t, sampleClient())
+			embeds, err := b.embedsSince(test.verb, sampleNow.AddDate(0, 0, -7), "this week", statsOptions{
+				queue:    test.queue,
+				lang:     riot.DefaultLanguage,
+				priority: riot.PriorityInteractive,
+				puuid:    test.puuid,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chdir(pkgDir); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "embeds_"+test.name, embeds)
+		})
+	}
+}
+
+func TestTFTEmbedsGolden(t *testing.T) {
+	pkgDir, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name  string
+		puuid string
+		verb  string
+	}{
+		{"short", samplePUUID, "short"},
+		{"best", samplePUUID, "best"},
+		{"worst", samplePUUID, "worst"},
+		{"unranked", unrankedPUUID, "short"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b := newTestBot(t, sampleClient())
+			embeds, err := b.tftEmbedsSince(test.verb, sampleNow.AddDate(0, 0, -7), "this week", statsOptions{
+				lang:     riot.DefaultLanguage,
+				priority: riot.PriorityInteractive,
+				puuid:    test.puuid,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chdir(pkgDir); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "tft_"+test.name, embeds)
+		})
+	}
+}
+
+// The same player as sampleClient, but served up by a fake Riot API so the real client does the converting
+func sampleScenario() riottest.Scenario {
+	ago := func(hours int) int64 { return sampleNow.Add(-time.Duration(hours) * time.Hour).UnixMilli() }
+	match := func(id string, queue int32, created int64, player lol.ParticipantV5DTO) lol.MatchV5DTO {
+		player.PUUID = samplePUUID
+		return lol.MatchV5DTO{
+			Metadata: lol.MetadataV5DTO{MatchID: id, Participants: []string{samplePUUID}},
+			Info:     lol.InfoV5DTO{QueueID: queue, GameCreation: created, Participants: []lol.ParticipantV5DTO{player}},
+		}
+	}
+	keystone := func(perk int32) lol.PerksV5DTO {
+		return lol.PerksV5DTO{Styles: []lol.PerkStyleV5DTO{{Selections: []lol.PerkStyleSelectionV5DTO{{Perk: perk}}}}}
+	}
+	return riottest.Scenario{
+		Version:   "14.5.1",
+		Accounts:  []equinoxriot.AccountV1DTO{{PUUID: samplePUUID, GameName: "simipangpang", TagLine: "NA1"}},
+		Summoners: []lol.SummonerV4DTO{{PUUID: samplePUUID, ID: "summoner-simi", ProfileIconID: 4568}},
+		Leagues: map[string][]lol.LeagueEntryV4DTO{
+			"summoner-simi": {{QueueType: "RANKED_SOLO_5x5", Tier: "GOLD", Rank: "II", Wins: 30, Losses: 20, LeaguePoints: 45}},
+		},
+		Masteries: map[string][]lol.ChampionMasteryV4DTO{
+			samplePUUID: {{ChampionID: 222, ChampionPoints: 12000}, {ChampionID: 103, ChampionPoints: 250000}},
+		},
+		Champions: []ddragon.FullChampion{
+			{ID: "Ahri", Key: "103", Name: "Ahri"},
+			{ID: "Jinx", Key: "222", Name: "Jinx"},
+		},
+		Items: []riot.Item{
+			{ID: 3089, Name: "Rabadon's Deathcap", Image: "3089.png"},
+			{ID: 3031, Name: "Infinity Edge", Image: "3031.png"},
+		},
+		Runes: []riot.Rune{
+			{ID: 8112, Name: "Electrocute", Icon: "perk-images/Styles/Domination/Electrocute/Electrocute.png"},
+			{ID: 8008, Name: "Lethal Tempo", Icon: "perk-images/Styles/Precision/LethalTempo/LethalTempoTemp.png"},
+		},
+		Spells: []riot.SummonerSpell{
+			{ID: 4, Name: "Flash", Image: "SummonerFlash.png"},
+			{ID: 14, Name: "Ignite", Image: "SummonerDot.png"},
+		},
+		Matches: []lol.MatchV5DTO{
+			match("NA1_4", 420, ago(24*10), lol.ParticipantV5DTO{Kills: 30, ChampionID: 103, Win: true}),
+			match("NA1_3", 420, ago(50), lol.ParticipantV5DTO{Kills: 5, Deaths: 5, Assists: 5, ChampionID: 222, Win: true,
+				Item0: 3031, Summoner1ID: 4, Summoner2ID: 14, Perks: keystone(8008)}),
+			match("NA1_2", 420, ago(30), lol.ParticipantV5DTO{Kills: 2, Deaths: 7, Assists: 3, ChampionID: 222,
+				Item0: 3031, Summoner1ID: 4, Summoner2ID: 14, Perks: keystone(8008)}),
+			match("NA1_5", 450, ago(10), lol.ParticipantV5DTO{Kills: 15, Deaths: 9, Assists: 30, ChampionID: 222, Win: true}),
+			match("NA1_1", 420, ago(5), lol.ParticipantV5DTO{Kills: 10, Deaths: 2, Assists: 8, ChampionID: 103, Win: true,
+				Item0: 3089, Summoner1ID: 4, Summoner2ID: 14, Perks: keystone(8112)}),
+		},
+	}
+}
+
+// Goes all the way through the Riot client instead of riotfake, so the golden file covers the converting too
+// The real client, talking to srv instead of Riot
+func riottestClient(t *testing.T, srv *riottest.Server) *riot.Client {
+	t.Helper()
+	t.Setenv("RIOT_TOKEN", "test")
+	// Setenv puts it back afterwards, Unsetenv alone wouldn't
+	t.Setenv("RIOT_TOKEN_FILE", "")
+	os.Unsetenv("RIOT_TOKEN_FILE")
+	client, err := riot.New(5*time.Second, riot.WithBaseURL(srv.BaseURL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestEmbedsFromRiotAPI(t *testing.T) {
+	pkgDir, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := riottest.NewServer(sampleScenario())
+	defer srv.Close()
+	b := newTestBot(t, riottestClient(t, srv))
+	embeds, err := b.embedsSince("all", sampleNow.AddDate(0, 0, -7), "this week", statsOptions{
+		queue:    riot.QueueRanked,
+		lang:     riot.DefaultLanguage,
+		priority: riot.PriorityInteractive,
+		puuid:    samplePUUID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(pkgDir); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "embeds_riot_api", embeds)
+}
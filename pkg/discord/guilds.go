@@ -0,0 +1,181 @@
+// Keeping server state in sync with Discord: joining and leaving guilds, and update channels getting deleted.
+
+package discord
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// State for guilds the bot got removed from goes here instead of getting deleted, in case it comes back
+const archiveDir = stateDir + "/archive"
+
+func archiveFileName(guildID string) string {
+	return fmt.Sprintf("%v/%v%v", archiveDir, guildID, saveExt)
+}
+
+// Whether Discord rejected the request with one of the codes
+func restErrorIs(err error, codes ...int) bool {
+	restErr := (*discord.RESTError)(nil)
+	if !errors.As(err, &restErr) || restErr.Message == nil {
+		return false
+	}
+	for _, code := range codes {
+		if restErr.Message.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the bot can't see the guild anymore, as opposed to Discord just having problems
+func (b *Bot) guildGone(guildID string) bool {
+	_, err := b.session.Guild(guildID)
+	return restErrorIs(err, discord.ErrCodeUnknownGuild, discord.ErrCodeMissingAccess)
+}
+
+// Moves the save (and its backup) out of the way so it doesn't get loaded on startup
+func archiveServer(guildID string) error {
+	if err := os.MkdirAll(archiveDir, dirMode); err != nil {
+		return fmt.Errorf("couldn't create archive directory: %v", err)
+	}
+	save := fmt.Sprintf("%v/%v%v", stateDir, guildID, saveExt)
+	if err := os.Rename(save, archiveFileName(guildID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("couldn't archive server save: %v", err)
+	}
+	backup := fmt.Sprintf("%v/%v-backup%v", stateDir, guildID, saveExt)
+	if err := os.Remove(backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("couldn't remove server backup: %v", err)
+	}
+	return nil
+}
+
+// Puts an archived save back, if there is one. Returns whether there was.
+func unarchiveServer(guildID string) (bool, error) {
+	save := fmt.Sprintf("%v/%v%v", stateDir, guildID, saveExt)
+	if err := os.Rename(archiveFileName(guildID), save); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("couldn't restore archived server save: %v", err)
+	}
+	return true, nil
+}
+
+// Tells a server's admins about something they need to fix. It goes in the system channel if the bot
+// can post there, otherwise the guild owner gets a DM.
+func (b *Bot) notifyAdmins(guild *discord.Guild, content string) {
+	if guild.SystemChannelID != "" {
+		perms, err := b.PermsByIDs(b.User().ID, guild.SystemChannelID)
+		if err == nil && perms&discord.PermissionSendMessages != 0 {
+			if _, err := b.session.ChannelMessageSend(guild.SystemChannelID, content); err == nil {
+				return
+			} else {
+				b.log.Printf("Couldn't notify admins of server %v in system channel: %v", guild.ID, err)
+			}
+		}
+	}
+	channel, err := b.session.UserChannelCreate(guild.OwnerID)
+	if err != nil {
+		b.log.Printf("Couldn't open DM with owner of server %v: %v", guild.ID, err)
+		return
+	}
+	if _, err := b.session.ChannelMessageSend(channel.ID, content); err != nil {
+		b.log.Printf("Couldn't notify owner of server %v: %v", guild.ID, err)
+	}
+}
+
+// These go in before the session opens, since Discord sends a GuildCreate for every guild right after connecting
+func (b *Bot) addGuildListeners() {
+	b.session.AddHandler(b.onGuildCreate)
+	b.session.AddHandler(b.onGuildDelete)
+	b.session.AddHandler(b.onChannelDelete)
+}
+
+// Also fires for every guild the bot's already in when it connects, which are already loaded
+func (b *Bot) onGuildCreate(_ *discord.Session, g *discord.GuildCreate) {
+	if server, ok := b.servers.get(g.ID); ok {
+		// Couldn't tell anyone about this during loading since the bot wasn't connected yet
+		id, hidden, ok := server.takeMissingChannel()
+		if ok && hidden {
+			b.notifyAdmins(server.guild, fmt.Sprintf(
+				":warning: The bot can't see the update channel for **%v** (<#%v>) anymore, so updates will fail until it has access again.",
+				server.guild.Name, id,
+			))
+		} else if ok {
+			if err := server.Save(); err != nil {
+				b.log.Printf("Couldn't save server %v after its update channel went missing: %v", g.ID, err)
+			}
+			b.notifyAdmins(server.guild, fmt.Sprintf(
+				":warning: The update channel for **%v** (<#%v>) is gone, so updates are off until a new one is set with `/update channel set`.",
+				server.guild.Name, id,
+			))
+		}
+		return
+	}
+
+	restored, err := unarchiveServer(g.ID)
+	if err != nil {
+		b.log.Printf("Couldn't restore server %v: %v", g.ID, err)
+	}
+	server, err := ServerFromFile(b, b.log.Writer(), g.ID)
+	if err != nil {
+		b.log.Printf("Couldn't create server for guild %v: %v", g.ID, err)
+		return
+	}
+	server = b.servers.add(g.ID, server)
+	if restored {
+		b.log.Printf("Rejoined guild %v (%v), restored its old settings", g.ID, g.Name)
+	} else {
+		b.log.Printf("Joined guild %v (%v)", g.ID, g.Name)
+	}
+	if err := server.Save(); err != nil {
+		b.log.Printf("Couldn't save server %v after joining: %v", g.ID, err)
+	}
+}
+
+func (b *Bot) onGuildDelete(_ *discord.Session, g *discord.GuildDelete) {
+	if g.Unavailable {
+		// Discord's having an outage, the guild is coming back
+		b.log.Printf("Guild %v is unavailable", g.ID)
+		return
+	}
+
+	server, ok := b.servers.remove(g.ID)
+	if ok {
+		// Saves everything (like when the last update went out) and waits for anything that's still
+		// writing, so nothing recreates the save after it's archived
+		server.Stop()
+	}
+	if err := archiveServer(g.ID); err != nil {
+		b.log.Printf("Couldn't archive server %v: %v", g.ID, err)
+		return
+	}
+	b.log.Printf("Removed from guild %v, archived its settings", g.ID)
+}
+
+// Only the update channel gets reset, everything else stays the same
+func (b *Bot) onChannelDelete(_ *discord.Session, c *discord.ChannelDelete) {
+	if c.GuildID == "" {
+		return
+	}
+	server, ok := b.servers.get(c.GuildID)
+	if !ok {
+		return
+	}
+	channel := server.Channel()
+	if channel == nil || channel.ID != c.ID {
+		return
+	}
+
+	server.ResetChannel()
+	if err := server.Save(); err != nil {
+		b.log.Printf("Couldn't save server %v after its update channel was deleted: %v", c.GuildID, err)
+	}
+	b.notifyAdmins(server.guild, fmt.Sprintf(
+		":warning: The update channel for **%v** (#%v) was deleted, so updates are off until a new one is set with `/update channel set`.",
+		server.guild.Name, c.Name,
+	))
+}
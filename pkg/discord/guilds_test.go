@@ -0,0 +1,289 @@
+package discord
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+func savedState(t *testing.T, server *Server) serverState {
+	t.Helper()
+	contents, err := os.ReadFile(server.SaveFileName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := serverState{}
+	if err := json.Unmarshal(contents, &state); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestGuildLeaveAndRejoin(t *testing.T) {
+	b, fake := newFakeDiscordBot(t, sampleClient())
+	fake.addChannel("channel", "guild")
+	server, err := b.ServerFor("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetChannel("channel"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetPeriod(30); err != nil {
+		t.Fatal(err)
+	}
+	server.Link("user", samplePUUID)
+	if err := server.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	b.onGuildDelete(nil, &discord.GuildDelete{Guild: &discord.Guild{ID: "guild"}})
+	if _, ok := b.servers.get("guild"); ok {
+		t.Fatal("server is still around after leaving")
+	}
+	if _, err := os.Stat(server.SaveFileName()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("save is still there after leaving (stat says %v)", err)
+	}
+	if _, err := os.Stat(archiveFileName("guild")); err != nil {
+		t.Fatalf("server wasn't archived: %v", err)
+	}
+
+	b.onGuildCreate(nil, &discord.GuildCreate{Guild: &discord.Guild{ID: "guild"}})
+	restored, ok := b.servers.get("guild")
+	if !ok {
+		t.Fatal("no server after rejoining")
+	}
+	if channel := restored.Channel(); channel == nil || channel.ID != "channel" {
+		t.Errorf("got update channel %v, want the one from before", channel)
+	}
+	if period := restored.GetPeriod(); period != 30 {
+		t.Errorf("got period %v, want 30", period)
+	}
+	if puuid, ok := restored.LinkFor("user"); !ok || puuid != samplePUUID {
+		t.Errorf("got link %v, %v, want %v", puuid, ok, samplePUUID)
+	}
+	if _, err := os.Stat(archiveFileName("guild")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("archive is still there after restoring it (stat says %v)", err)
+	}
+
+	// Somewhere the bot's never been before starts from scratch
+	b.onGuildCreate(nil, &discord.GuildCreate{Guild: &discord.Guild{ID: "new-guild"}})
+	fresh, ok := b.servers.get("new-guild")
+	if !ok {
+		t.Fatal("no server after joining")
+	}
+	if fresh.Channel() != nil || fresh.GetPeriod() != 0 || len(fresh.Links()) != 0 {
+		t.Error("new server didn't start with default settings")
+	}
+	if _, err := os.Stat(fresh.SaveFileName()); err != nil {
+		t.Errorf("new server wasn't saved: %v", err)
+	}
+}
+
+// A Discord outage isn't the bot getting removed
+func TestGuildUnavailable(t *testing.T) {
+	b, fake := newFakeDiscordBot(t, sampleClient())
+	fake.addChannel("channel", "guild")
+	server, err := b.ServerFor("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	b.onGuildDelete(nil, &discord.GuildDelete{Guild: &discord.Guild{ID: "guild", Unavailable: true}})
+	if _, ok := b.servers.get("guild"); !ok {
+		t.Error("server was removed during an outage")
+	}
+	if _, err := os.Stat(archiveFileName("guild")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("server was archived during an outage (stat says %v)", err)
+	}
+}
+
+// The update channel going missing while the bot was down gets noticed when it starts back up
+func TestMissingChannelOnStartup(t *testing.T) {
+	tests := []struct {
+		name   string
+		hidden bool
+		// Whether the channel should still be set afterwards
+		kept bool
+		want string
+	}{
+		{"deleted", false, false, "is gone, so updates are off"},
+		{"hidden", true, true, "can't see the update channel"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, fake := newFakeDiscordBot(t, sampleClient())
+			fake.addChannel("channel", "guild")
+			server, err := b.ServerFor("guild")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := server.SetChannel("channel"); err != nil {
+				t.Fatal(err)
+			}
+			server.Link("user", samplePUUID)
+			if err := server.Save(); err != nil {
+				t.Fatal(err)
+			}
+			server.Stop()
+			b.servers.remove("guild")
+
+			// Starting back up with the channel in a different state
+			fake.mu.Lock()
+			if test.hidden {
+				fake.hidden["channel"] = true
+			} else {
+				delete(fake.channels, "channel")
+			}
+			fake.mu.Unlock()
+			// Otherwise it comes straight out of the cache
+			b.session.State.ChannelRemove(&discord.Channel{ID: "channel", GuildID: "guild"})
+			if err := b.Load(); err != nil {
+				t.Fatal(err)
+			}
+			loaded, ok := b.servers.get("guild")
+			if !ok {
+				t.Fatal("server didn't load, the rest of its settings should've been kept")
+			}
+			if puuid, ok := loaded.LinkFor("user"); !ok || puuid != samplePUUID {
+				t.Errorf("lost the link to %v", samplePUUID)
+			}
+
+			// Nobody can be told until the bot connects
+			b.onGuildCreate(nil, &discord.GuildCreate{Guild: &discord.Guild{ID: "guild"}})
+			messages := fake.messagesTo("dm-owner")
+			if len(messages) != 1 || !strings.Contains(messages[0], test.want) {
+				t.Errorf("got messages %q to the owner, want one saying %q", messages, test.want)
+			}
+			channel := loaded.Channel()
+			if kept := channel != nil && channel.ID == "channel"; kept != test.kept {
+				t.Errorf("got update channel %v, want it kept %v", channel, test.kept)
+			}
+			if saved := savedState(t, loaded).ChannelID; (saved == "channel") != test.kept {
+				t.Errorf("got channel %q in the save, want it kept %v", saved, test.kept)
+			}
+
+			// Only once, not every time Discord reconnects
+			b.onGuildCreate(nil, &discord.GuildCreate{Guild: &discord.Guild{ID: "guild"}})
+			if n := fake.sentTo("dm-owner"); n != 1 {
+				t.Errorf("owner got %v messages, want 1", n)
+			}
+		})
+	}
+}
+
+func TestGuildGoneOnStartup(t *testing.T) {
+	b, fake := newFakeDiscordBot(t, sampleClient())
+	fake.addChannel("channel", "guild")
+	server, err := b.ServerFor("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Save(); err != nil {
+		t.Fatal(err)
+	}
+	server.Stop()
+	b.servers.remove("guild")
+
+	fake.mu.Lock()
+	fake.gone["guild"] = true
+	fake.mu.Unlock()
+	if err := b.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.servers.get("guild"); ok {
+		t.Error("loaded a server for a guild the bot was removed from")
+	}
+	if _, err := os.Stat(archiveFileName("guild")); err != nil {
+		t.Errorf("server wasn't archived: %v", err)
+	}
+}
+
+func TestUpdateChannelDeleted(t *testing.T) {
+	b, fake := newFakeDiscordBot(t, sampleClient())
+	fake.addChannel("channel", "guild")
+	fake.addChannel("other", "guild")
+	server, err := b.ServerFor("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetChannel("channel"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetPeriod(30); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Some other channel doesn't matter
+	b.onChannelDelete(nil, &discord.ChannelDelete{Channel: &discord.Channel{ID: "other", GuildID: "guild", Name: "other"}})
+	if channel := server.Channel(); channel == nil || channel.ID != "channel" {
+		t.Fatalf("update channel changed to %v when another channel was deleted", channel)
+	}
+	if n := fake.sentTo("dm-owner"); n != 0 {
+		t.Fatalf("owner got %v messages about another channel", n)
+	}
+
+	b.onChannelDelete(nil, &discord.ChannelDelete{Channel: &discord.Channel{ID: "channel", GuildID: "guild", Name: "updates"}})
+	if channel := server.Channel(); channel != nil {
+		t.Errorf("update channel is still %v after it was deleted", channel.ID)
+	}
+	if saved := savedState(t, server); saved.ChannelID != "" || saved.PeriodMinutes != 30 {
+		t.Errorf("got channel %q and period %v saved, want no channel and the period kept", saved.ChannelID, saved.PeriodMinutes)
+	}
+	if messages := fake.messagesTo("dm-owner"); len(messages) != 1 || !strings.Contains(messages[0], "(#updates) was deleted") {
+		t.Errorf("got messages %q to the owner, want one about #updates", messages)
+	}
+}
+
+func TestNotifyAdmins(t *testing.T) {
+	tests := []struct {
+		name string
+		// Empty for no system channel
+		system   string
+		hidden   bool
+		readOnly bool
+		// Where the message should end up
+		want string
+	}{
+		{"system channel", "system", false, false, "system"},
+		{"no system channel", "", false, false, "dm-owner"},
+		{"can't send in the system channel", "system", false, true, "dm-owner"},
+		{"can't see the system channel", "system", true, false, "dm-owner"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, fake := newFakeDiscordBot(t, sampleClient())
+			fake.addChannel("system", "guild")
+			fake.mu.Lock()
+			fake.systemChannels["guild"] = test.system
+			fake.hidden["system"] = test.hidden
+			fake.readOnly["system"] = test.readOnly
+			fake.mu.Unlock()
+			guild, err := b.GuildByID("guild")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b.notifyAdmins(guild, "something's wrong")
+			for _, channel := range []string{"system", "dm-owner"} {
+				want := 0
+				if channel == test.want {
+					want = 1
+				}
+				if n := fake.sentTo(channel); n != want {
+					t.Errorf("%v got %v messages, want %v", channel, n, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	discord "github.com/bwmarrin/discordgo"
+	"github.com/thatliuser/simipangpang/pkg/riot"
+)
+
+// Everything saves to state/ relative to the working directory, so each test gets its own
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// A bot with no Discord session, which is all that's needed to build embeds
+func newTestBot(t *testing.T, client riot.Provider) *Bot {
+	t.Helper()
+	inTempDir(t)
+	b := newBot(nil, client, riot.DefaultCalendar(), io.Discard)
+	if err := b.loadTracked(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.loadLadder(); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Just enough of Discord's REST API for servers to look up guilds and channels and send messages
+type fakeDiscord struct {
+	mu sync.Mutex
+	// Channel ID to guild ID
+	channels map[string]string
+	// Channels the bot isn't allowed to see, or can see but not send messages in
+	hidden   map[string]bool
+	readOnly map[string]bool
+	// Guild ID to its system channel ID
+	systemChannels map[string]string
+	// Guilds the bot isn't in anymore
+	gone map[string]bool
+	// Message contents sent, by channel ID. DMs go to "dm-" and the user ID.
+	sent map[string][]string
+	// If it's set, sending a message signals on sending and then waits for release
+	sending chan string
+	release chan struct{}
+}
+
+func newFakeDiscord() *fakeDiscord {
+	return &fakeDiscord{
+		channels:       make(map[string]string),
+		hidden:         make(map[string]bool),
+		readOnly:       make(map[string]bool),
+		systemChannels: make(map[string]string),
+		gone:           make(map[string]bool),
+		sent:           make(map[string][]string),
+	}
+}
+
+func (f *fakeDiscord) addChannel(channelID string, guildID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.channels[channelID] = guildID
+}
+
+func (f *fakeDiscord) sentTo(channelID string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.sent[channelID])
+}
+
+func (f *fakeDiscord) messagesTo(channelID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.sent[channelID])
+}
+
+func fakeResponse(req *http.Request, status int, body any) (*http.Response, error) {
+	contents, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(contents)),
+		Request:    req,
+	}, nil
+}
+
+func (f *fakeDiscord) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Only the bits of the body that get checked
+	body := struct {
+		Content     string `json:"content"`
+		RecipientID string `json:"recipient_id"`
+	}{}
+	if req.Body != nil {
+		json.NewDecoder(req.Body).Decode(&body)
+		io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/api/v"+discord.APIVersion)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case req.Method == http.MethodGet && len(parts) == 2 && parts[0] == "guilds":
+		f.mu.Lock()
+		gone, systemChannel := f.gone[parts[1]], f.systemChannels[parts[1]]
+		f.mu.Unlock()
+		if gone {
+			return fakeResponse(req, http.StatusNotFound, discord.APIErrorMessage{Code: discord.ErrCodeUnknownGuild, Message: "Unknown Guild"})
+		}
+		// Everyone can send messages everywhere, unless the channel says otherwise
+		everyone := &discord.Role{ID: parts[1], Name: "@everyone", Permissions: discord.PermissionViewChannel | discord.PermissionSendMessages}
+		return fakeResponse(req, http.StatusOK, discord.Guild{
+			ID:              parts[1],
+			Name:            "Guild " + parts[1],
+			OwnerID:         "owner",
+			Roles:           []*discord.Role{everyone},
+			SystemChannelID: systemChannel,
+		})
+	case req.Method == http.MethodGet && len(parts) == 4 && parts[0] == "guilds" && parts[2] == "members":
+		return fakeResponse(req, http.StatusOK, discord.Member{GuildID: parts[1], User: &discord.User{ID: parts[3]}})
+	case req.Method == http.MethodGet && len(parts) == 2 && parts[0] == "channels":
+		f.mu.Lock()
+		guildID, ok := f.channels[parts[1]]
+		hidden, readOnly := f.hidden[parts[1]], f.readOnly[parts[1]]
+		f.mu.Unlock()
+		if !ok {
+			return fakeResponse(req, http.StatusNotFound, discord.APIErrorMessage{Code: discord.ErrCodeUnknownChannel, Message: "Unknown Channel"})
+		} else if hidden {
+			return fakeResponse(req, http.StatusForbidden, discord.APIErrorMessage{Code: discord.ErrCodeMissingAccess, Message: "Missing Access"})
+		}
+		channel := discord.Channel{ID: parts[1], GuildID: guildID, Type: discord.ChannelTypeGuildText}
+		if readOnly {
+			channel.PermissionOverwrites = []*discord.PermissionOverwrite{
+				{ID: guildID, Type: discord.PermissionOverwriteTypeRole, Deny: discord.PermissionSendMessages},
+			}
+		}
+		return fakeResponse(req, http.StatusOK, channel)
+	case req.Method == http.MethodPost && len(parts) == 3 && parts[0] == "users" && parts[2] == "channels":
+		return fakeResponse(req, http.StatusOK, discord.Channel{ID: "dm-" + body.RecipientID, Type: discord.ChannelTypeDM})
+	case req.Method == http.MethodPost && len(parts) == 3 && parts[0] == "channels" && parts[2] == "messages":
+		if f.sending != nil {
+			f.sending <- parts[1]
+			<-f.release
+		}
+		f.mu.Lock()
+		f.sent[parts[1]] = append(f.sent[parts[1]], body.Content)
+		f.mu.Unlock()
+		return fakeResponse(req, http.StatusOK, discord.Message{ID: "1", ChannelID: parts[1]})
+	default:
+		return fakeResponse(req, http.StatusNotFound, discord.APIErrorMessage{Message: "Not found"})
+	}
+}
+
+// A bot with a session that talks to a fake Discord instead of the real one
+func newFakeDiscordBot(t *testing.T, client riot.Provider) (*Bot, *fakeDiscord) {
+	t.Helper()
+	b := newTestBot(t, client)
+	fake := newFakeDiscord()
+	session, err := discord.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Client = &http.Client{Transport: fake}
+	session.State.User = &discord.User{ID: "bot"}
+	b.session = session
+	return b, fake
+}
@@ -0,0 +1,285 @@
+// Match history that can be paged through with buttons. Everything the buttons need is kept
+// in their custom IDs, so they still work after the bot restarts.
+
+package discord
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Kyagara/equinox/clients/ddragon"
+	discord "github.com/bwmarrin/discordgo"
+	"github.com/thatliuser/simipangpang/pkg/riot"
+)
+
+const historyPageSize = 10
+
+// Custom IDs can only be 100 characters and PUUIDs take up 78 of them, so everything else is really short
+const (
+	historyPrefix = "h"
+	historyPrev   = "p"
+	historyNext   = "n"
+	historyOpen   = "o"
+)
+
+// Everything needed to redraw a page of history
+type historyState struct {
+	puuid  string
+	queue  riot.Queue
+	window string
+	page   int
+}
+
+func (h historyState) customID(action string) (string, error) {
+	return encodeCustomID(historyPrefix, action, h.puuid, string(h.queue), h.window, strconv.Itoa(h.page))
+}
+
+// Returns the action along with the state
+func parseHistoryID(customID string) (string, historyState, error) {
+	prefix, fields := decodeCustomID(customID)
+	if prefix != historyPrefix || len(fields) != 5 {
+		return "", historyState{}, fmt.Errorf("history custom id not recognized: %v", customID)
+	}
+	queue, err := riot.ParseQueue(fields[2])
+	if err != nil {
+		return "", historyState{}, err
+	}
+	page, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return "", historyState{}, fmt.Errorf("couldn't parse history page: %v", err)
+	}
+	return fields[0], historyState{puuid: fields[1], queue: queue, window: fields[3], page: page}, nil
+}
+
+// Newest first
+func (b *Bot) historyMatches(state historyState, lk *lookup) (*riot.Account, []*riot.Match, string, error) {
+	account, err := b.accountFor(statsOptions{puuid: state.puuid}, lk)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	since, desc, err := b.windowStart(state.window)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	matches, err := b.matchesOrSnapshot(account, state.queue, since, lk)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	slices.SortFunc(matches, func(one, two *riot.Match) int {
+		return two.Time.Compare(one.Time)
+	})
+	return account, matches, desc, nil
+}
+
+func (b *Bot) matchSummary(match *riot.Match, lang ddragon.Language) string {
+	champ := "Unknown champion"
+	if info, err := b.client.ChampionByID(int(match.Champ), lang); err == nil {
+		champ = info.Name
+	}
+	result := "Loss"
+	if match.Queue.HasPlacements() {
+		result = ordinal(match.Placement)
+	} else if match.Won {
+		result = "Win"
+	}
+	return fmt.Sprintf("%v %v/%v/%v (%v)", champ, match.Kills, match.Deaths, match.Assists, result)
+}
+
+func (b *Bot) historyMessage(state historyState, lang ddragon.Language, lk *lookup) ([]*discord.MessageEmbed, []discord.MessageComponent, error) {
+	account, matches, desc, err := b.historyMatches(state, lk)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Remember who it was, in case it was the default player and that changes
+	state.puuid = account.PUUID
+	pages := max((len(matches)+historyPageSize-1)/historyPageSize, 1)
+	// New matches can push the last page out from under the buttons
+	state.page = min(max(state.page, 1), pages)
+	start := (state.page - 1) * historyPageSize
+	page := matches[start:min(start+historyPageSize, len(matches))]
+
+	lines := []string{}
+	options := []discord.SelectMenuOption{}
+	for i, match := range page {
+		summary := b.matchSummary(match, lang)
+		lines = append(lines, fmt.Sprintf("**%v.** %v <t:%v:R>", start+i+1, summary, match.Time.Unix()))
+		if match.ID != "" {
+			options = append(options, discord.SelectMenuOption{
+				Label:       summary,
+				Value:       match.ID,
+				Description: match.Time.Format("Jan 2, 3:04 PM MST"),
+			})
+		}
+	}
+	content := strings.Join(lines, "\n")
+	if len(lines) == 0 {
+		content = "No matches found"
+	}
+
+	embeds := []*discord.MessageEmbed{
+		{
+			Color: 0xF7F12F,
+			Author: &discord.MessageEmbedAuthor{
+				Name:    fmt.Sprintf("%v#%v", account.Name, account.Discrim),
+				IconURL: account.IconURL,
+			},
+			Description: content,
+			Footer: &discord.MessageEmbedFooter{
+				Text: fmt.Sprintf("Page %v/%v • %v matches %v", state.page, pages, state.queue.Name(), desc),
+			},
+		},
+	}
+	prevID, err := state.customID(historyPrev)
+	if err != nil {
+		return nil, nil, err
+	}
+	nextID, err := state.customID(historyNext)
+	if err != nil {
+		return nil, nil, err
+	}
+	openID, err := state.customID(historyOpen)
+	if err != nil {
+		return nil, nil, err
+	}
+	components := []discord.MessageComponent{
+		discord.ActionsRow{
+			Components: []discord.MessageComponent{
+				discord.Button{
+					Label:    "Previous",
+					Style:    discord.SecondaryButton,
+					CustomID: prevID,
+					Disabled: state.page <= 1,
+				},
+				discord.Button{
+					Label:    "Next",
+					Style:    discord.SecondaryButton,
+					CustomID: nextID,
+					Disabled: state.page >= pages,
+				},
+			},
+		},
+	}
+	// Discord won't take a menu with nothing in it
+	if len(options) > 0 {
+		components = append(components, discord.ActionsRow{
+			Components: []discord.MessageComponent{
+				discord.SelectMenu{
+					CustomID:    openID,
+					Placeholder: "Show a match",
+					Options:     options,
+				},
+			},
+		})
+	}
+	return embeds, components, nil
+}
+
+func (b *Bot) onHistory(i *discord.InteractionCreate) {
+	// Acknowledge the interaction first
+	b.session.InteractionRespond(i.Interaction, &discord.InteractionResponse{
+		Type: discord.InteractionResponseDeferredChannelMessageWithSource,
+	})
+
+	opts, err := statsOptionsFrom(i.ApplicationCommandData().Options, b.languageFor(i.GuildID))
+	if err == nil {
+		opts.puuid, err = b.playerFor(i, opts.user, opts.player)
+	}
+	embeds := []*discord.MessageEmbed{}
+	components := []discord.MessageComponent{}
+	if err == nil {
+		opts.guild = i.GuildID
+		lk := b.newLookup(opts)
+		state := historyState{puuid: opts.puuid, queue: opts.queue, window: opts.window, page: 1}
+		embeds, components, err = b.historyMessage(state, opts.lang, lk)
+		lk.mark(embeds)
+	}
+
+	if err != nil {
+		b.log.Printf("Error retrieving history for user: %v", err)
+		errString := fmt.Sprintf(":warning: Failed with error: %v", err)
+		if _, err := b.session.InteractionResponseEdit(i.Interaction, &discord.WebhookEdit{
+			Content: &errString,
+		}); err != nil {
+			b.log.Printf("Error sending error replying to message: %v", err)
+		}
+	} else {
+		if _, err := b.session.InteractionResponseEdit(i.Interaction, &discord.WebhookEdit{
+			Embeds:     &embeds,
+			Components: &components,
+		}); err != nil {
+			b.log.Printf("Error sending reply to message: %v", err)
+		}
+	}
+}
+
+// Handles the buttons and the select menu on a history message
+func (b *Bot) onHistoryComponent(i *discord.InteractionCreate) {
+	data := i.MessageComponentData()
+	action, state, err := parseHistoryID(data.CustomID)
+	if err != nil {
+		b.log.Printf("Error handling history component: %v", err)
+		return
+	}
+	lang := b.languageFor(i.GuildID)
+	lk := b.newLookup(statsOptions{guild: i.GuildID, puuid: state.puuid})
+
+	if action == historyOpen {
+		// Opens in its own message so the list sticks around
+		b.respondEphemeral(i, func() (string, []*discord.MessageEmbed, error) {
+			if len(data.Values) != 1 {
+				return "", nil, fmt.Errorf("didn't pick a match")
+			}
+			account, matches, desc, err := b.historyMatches(state, lk)
+			if err != nil {
+				return "", nil, err
+			}
+			idx := slices.IndexFunc(matches, func(match *riot.Match) bool { return match.ID == data.Values[0] })
+			if idx < 0 {
+				return "", nil, fmt.Errorf("match %v isn't in the history anymore", data.Values[0])
+			}
+			caption := fmt.Sprintf("%v match %v", state.queue.Name(), desc)
+			embeds, err := b.matchEmbed(account, matches[idx], caption, lang)
+			if err != nil {
+				return "", nil, err
+			}
+			lk.mark(embeds)
+			return "", embeds, nil
+		})
+		return
+	}
+
+	switch action {
+	case historyPrev:
+		state.page--
+	case historyNext:
+		state.page++
+	default:
+		b.log.Printf("History action not recognized: %v", action)
+		return
+	}
+	// Acknowledge the interaction first, the message gets edited in place
+	b.session.InteractionRespond(i.Interaction, &discord.InteractionResponse{
+		Type: discord.InteractionResponseDeferredMessageUpdate,
+	})
+	embeds, components, err := b.historyMessage(state, lang, lk)
+	if err != nil {
+		b.log.Printf("Error retrieving history for user: %v", err)
+		errString := fmt.Sprintf(":warning: Failed with error: %v", err)
+		if _, err := b.session.FollowupMessageCreate(i.Interaction, false, &discord.WebhookParams{
+			Content: errString,
+			Flags:   discord.MessageFlagsEphemeral,
+		}); err != nil {
+			b.log.Printf("Error sending error replying to message: %v", err)
+		}
+		return
+	}
+	lk.mark(embeds)
+	if _, err := b.session.InteractionResponseEdit(i.Interaction, &discord.WebhookEdit{
+		Embeds:     &embeds,
+		Components: &components,
+	}); err != nil {
+		b.log.Printf("Error sending reply to message: %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+// Everything the bot does on a timer (updates for every server, split recaps) goes through here,
+// so there's one timer and one goroutine instead of one per server.
+
+package discord
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+// More than this and the message gets too long
+const maxJobsShown = 20
+
+type job struct {
+	// Scheduling something under a key that's already taken replaces it
+	key string
+	// Empty for jobs that aren't for a specific server
+	guild string
+	at    time.Time
+	run   func()
+	// Where it is in the heap, so it can be removed
+	index int
+}
+
+// Soonest job first. Implements heap.Interface.
+type jobHeap []*job
+
+func (h jobHeap) Len() int           { return len(h) }
+func (h jobHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h jobHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *jobHeap) Push(x any) {
+	j := x.(*job)
+	j.index = len(*h)
+	*h = append(*h, j)
+}
+
+func (h *jobHeap) Pop() any {
+	old := *h
+	j := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	j.index = -1
+	return j
+}
+
+// What /jobs shows
+type jobInfo struct {
+	key   string
+	guild string
+	at    time.Time
+}
+
+type jobs struct {
+	log   *log.Logger
+	mu    sync.Mutex
+	queue jobHeap
+	byKey map[string]*job
+	// Pokes the run loop when the soonest job changes
+	wake chan struct{}
+}
+
+func newJobs(log *log.Logger) *jobs {
+	return &jobs{
+		log:   log,
+		byKey: make(map[string]*job),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Runs the job at the given time, replacing whatever was scheduled under the key before.
+// Jobs can be scheduled before Run is called, they just won't go off until it is.
+func (j *jobs) Schedule(key string, guild string, at time.Time, run func()) {
+	j.mu.Lock()
+	if old, ok := j.byKey[key]; ok {
+		heap.Remove(&j.queue, old.index)
+	}
+	next := &job{key: key, guild: guild, at: at, run: run}
+	heap.Push(&j.queue, next)
+	j.byKey[key] = next
+	j.mu.Unlock()
+	j.poke()
+}
+
+// Returns whether there was anything to cancel
+func (j *jobs) Cancel(key string) bool {
+	j.mu.Lock()
+	old, ok := j.byKey[key]
+	if ok {
+		heap.Remove(&j.queue, old.index)
+		delete(j.byKey, key)
+	}
+	j.mu.Unlock()
+	if ok {
+		j.poke()
+	}
+	return ok
+}
+
+func (j *jobs) poke() {
+	select {
+	case j.wake <- struct{}{}:
+	default:
+		// Already going to wake up
+	}
+}
+
+// Everything that's scheduled, soonest first
+func (j *jobs) Upcoming() []jobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	upcoming := []jobInfo{}
+	for _, next := range j.queue {
+		upcoming = append(upcoming, jobInfo{key: next.key, guild: next.guild, at: next.at})
+	}
+	sort.Slice(upcoming, func(a, b int) bool {
+		return upcoming[a].at.Before(upcoming[b].at)
+	})
+	return upcoming
+}
+
+// Pops everything that's due, and says how long until the next one otherwise
+func (j *jobs) due(now time.Time) ([]*job, time.Duration, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	ready := []*job{}
+	for len(j.queue) > 0 && !j.queue[0].at.After(now) {
+		next := heap.Pop(&j.queue).(*job)
+		delete(j.byKey, next.key)
+		ready = append(ready, next)
+	}
+	if len(j.queue) == 0 {
+		return ready, 0, false
+	}
+	return ready, j.queue[0].at.Sub(now), true
+}
+
+// Runs jobs as they come due until ctx is done
+func (j *jobs) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		ready, wait, ok := j.due(time.Now())
+		for _, next := range ready {
+			// Each in its own goroutine so a slow update doesn't hold up everyone else's
+			go next.run()
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if ok {
+			timer.Reset(wait)
+		}
+		select {
+		case <-timer.C:
+		case <-j.wake:
+		case <-ctx.Done():
+			j.log.Println("Stopping scheduled jobs")
+			return
+		}
+	}
+}
+
+// The owner sees everything, everyone else only sees what's scheduled for their server
+func (b *Bot) onJobs(i *discord.InteractionCreate) {
+	user := interactionUser(i)
+	all := b.owner != "" && user != nil && user.ID == b.owner
+
+	lines := []string{}
+	for _, next := range b.jobs.Upcoming() {
+		if !all && (next.guild == "" || next.guild != i.GuildID) {
+			continue
+		}
+		if len(lines) == maxJobsShown {
+			lines = append(lines, "...")
+			break
+		}
+		lines = append(lines, fmt.Sprintf("`%v` <t:%v:f> (<t:%v:R>)", next.key, next.at.Unix(), next.at.Unix()))
+	}
+	resp := strings.Join(lines, "\n")
+	if len(lines) == 0 {
+		resp = "Nothing is scheduled"
+	}
+
+	if err := b.session.InteractionRespond(i.Interaction, &discord.InteractionResponse{
+		Type: discord.InteractionResponseChannelMessageWithSource,
+		Data: &discord.InteractionResponseData{
+			Flags:   discord.MessageFlagsEphemeral,
+			Content: resp,
+		},
+	}); err != nil {
+		b.log.Printf("Error sending reply to message: %v", err)
+	}
+}
@@ -0,0 +1,458 @@
+// Leaderboard for everyone that's linked an account in a server. Weekly LP gains come from
+// a baseline taken the first time each player is seen in a week. Pages are flipped with buttons,
+// which keep the sort and page in their custom IDs like the history ones do.
+
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	discord "github.com/bwmarrin/discordgo"
+	"github.com/thatliuser/simipangpang/pkg/riot"
+)
+
+const leaderboardPageSize = 10
+
+const (
+	leaderboardPrefix = "l"
+	leaderboardPrev   = "p"
+	leaderboardNext   = "n"
+)
+
+const (
+	sortRank    = "rank"
+	sortLP      = "lp"
+	sortWinrate = "winrate"
+	sortGames   = "games"
+)
+
+type lpBaseline struct {
+	// From riot.Account.RankScore
+	Score int32     `json:"score"`
+	At    time.Time `json:"at"`
+	// How much was gained in the week before this baseline was taken
+	LastWeek int32 `json:"last_week"`
+}
+
+// Stuff that gets JSON'ed, keyed by PUUID
+type ladderState struct {
+	Baselines map[string]*lpBaseline `json:"baselines"`
+}
+
+type ladder struct {
+	mu    sync.Mutex
+	state ladderState
+}
+
+func ladderFileName() string {
+	return fmt.Sprintf("%v/ladder%v", globalDir, saveExt)
+}
+
+func (b *Bot) loadLadder() error {
+	b.ladder.mu.Lock()
+	defer b.ladder.mu.Unlock()
+	b.ladder.state = ladderState{
+		Baselines: make(map[string]*lpBaseline),
+	}
+
+	contents, err := readFile(ladderFileName())
+	if err != nil {
+		return fmt.Errorf("couldn't open ladder: %v", err)
+	} else if contents == nil {
+		// Nothing recorded yet but it's fine
+		return nil
+	}
+	if err := json.Unmarshal(contents, &b.ladder.state); err != nil {
+		return fmt.Errorf("couldn't unmarshal ladder: %v", err)
+	}
+	if b.ladder.state.Baselines == nil {
+		b.ladder.state.Baselines = make(map[string]*lpBaseline)
+	}
+	return nil
+}
+
+func (b *Bot) saveLadder() error {
+	b.ladder.mu.Lock()
+	data, err := json.MarshalIndent(&b.ladder.state, "", "\t")
+	b.ladder.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("couldn't marshal ladder: %v", err)
+	}
+	if err := writeFile(ladderFileName(), data); err != nil {
+		return fmt.Errorf("couldn't save ladder: %v", err)
+	}
+	return nil
+}
+
+// Weeks start on Monday at midnight UTC
+func weekStart(t time.Time) time.Time {
+	t = t.UTC()
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+}
+
+// Takes a new baseline if the old one is from another week or split. Returns the LP gained this week.
+func (b *Bot) recordLP(account *riot.Account) int32 {
+	if !account.Ranked() {
+		// No LP to compare yet, placements shouldn't count as gaining a whole rank
+		return 0
+	}
+	b.ladder.mu.Lock()
+	defer b.ladder.mu.Unlock()
+	now := time.Now()
+	score := account.RankScore()
+	baseline, ok := b.ladder.state.Baselines[account.PUUID]
+	if ok && !baseline.At.Before(weekStart(now)) && !b.calendar.CrossesReset(baseline.At, now) {
+		return score - baseline.Score
+	}
+
+	next := &lpBaseline{Score: score, At: now}
+	// Only counts as last week's gains if the old baseline was actually from last week
+	if ok && !baseline.At.Before(weekStart(now).AddDate(0, 0, -7)) && !b.calendar.CrossesReset(baseline.At, now) {
+		next.LastWeek = score - baseline.Score
+	}
+	b.ladder.state.Baselines[account.PUUID] = next
+	return 0
+}
+
+func (b *Bot) lastWeekLP(puuid string) int32 {
+	b.ladder.mu.Lock()
+	defer b.ladder.mu.Unlock()
+	if baseline, ok := b.ladder.state.Baselines[puuid]; ok {
+		return baseline.LastWeek
+	}
+	return 0
+}
+
+type leaderboardEntry struct {
+	userID  string
+	account *riot.Account
+	gained  int32
+}
+
+func (e *leaderboardEntry) games() int32 {
+	return e.account.Wins + e.account.Losses
+}
+
+func (b *Bot) leaderboardEntries(server *Server, lastWeek bool, lk *lookup) ([]*leaderboardEntry, error) {
+	entries := []*leaderboardEntry{}
+	for userID, puuid := range server.Links() {
+		account, err := b.accountByPUUID(puuid, lk)
+		if err != nil {
+			// One broken account shouldn't take the whole leaderboard down
+			b.log.Printf("Couldn't get account %v for leaderboard: %v", puuid, err)
+			continue
+		}
+		entry := &leaderboardEntry{userID: userID, account: account, gained: b.recordLP(account)}
+		if lastWeek {
+			entry.gained = b.lastWeekLP(puuid)
+		}
+		entries = append(entries, entry)
+	}
+	if err := b.saveLadder(); err != nil {
+		b.log.Printf("Couldn't save ladder: %v", err)
+	}
+	return entries, nil
+}
+
+func sortLeaderboard(entries []*leaderboardEntry, by string) error {
+	compare := (func(one, two *leaderboardEntry) int)(nil)
+	switch by {
+	case "", sortRank:
+		compare = func(one, two *leaderboardEntry) int {
+			return int(two.account.RankScore() - one.account.RankScore())
+		}
+	case sortLP:
+		compare = func(one, two *leaderboardEntry) int {
+			return int(two.gained - one.gained)
+		}
+	case sortWinrate:
+		compare = func(one, two *leaderboardEntry) int {
+			if one.games() == 0 || two.games() == 0 {
+				return int(two.games() - one.games())
+			}
+			diff := two.account.Winrate() - one.account.Winrate()
+			if diff < 0 {
+				return -1
+			} else if diff > 0 {
+				return 1
+			}
+			return 0
+		}
+	case sortGames:
+		compare = func(one, two *leaderboardEntry) int {
+			return int(two.games() - one.games())
+		}
+	default:
+		return fmt.Errorf("sort not recognized: %v", by)
+	}
+	slices.SortStableFunc(entries, compare)
+	return nil
+}
+
+// Everything needed to redraw a page of the leaderboard. The guild comes from the interaction.
+type leaderboardState struct {
+	sort string
+	page int
+}
+
+func (l leaderboardState) customID(action string) (string, error) {
+	return encodeCustomID(leaderboardPrefix, action, l.sort, strconv.Itoa(l.page))
+}
+
+// Returns the action along with the state
+func parseLeaderboardID(customID string) (string, leaderboardState, error) {
+	prefix, fields := decodeCustomID(customID)
+	if prefix != leaderboardPrefix || len(fields) != 3 {
+		return "", leaderboardState{}, fmt.Errorf("leaderboard custom id not recognized: %v", customID)
+	}
+	page, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return "", leaderboardState{}, fmt.Errorf("couldn't parse leaderboard page: %v", err)
+	}
+	return fields[0], leaderboardState{sort: fields[1], page: page}, nil
+}
+
+func leaderboardPages(entries []*leaderboardEntry) int {
+	return max((len(entries)+leaderboardPageSize-1)/leaderboardPageSize, 1)
+}
+
+func (b *Bot) leaderboardMessage(guildID string, state leaderboardState, lk *lookup) ([]*discord.MessageEmbed, []discord.MessageComponent, error) {
+	if guildID == "" {
+		return nil, nil, fmt.Errorf("leaderboards only work in servers")
+	}
+	server, err := b.ServerFor(guildID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't get server for guild id %v: %v", guildID, err)
+	}
+	entries, err := b.leaderboardEntries(server, false, lk)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := sortLeaderboard(entries, state.sort); err != nil {
+		return nil, nil, err
+	}
+	pages := leaderboardPages(entries)
+	// People can unlink while the buttons are still around
+	state.page = min(max(state.page, 1), pages)
+	embeds, err := b.leaderboardEmbed(entries, state.sort, state.page, "Leaderboard", "this week")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prevID, err := state.customID(leaderboardPrev)
+	if err != nil {
+		return nil, nil, err
+	}
+	nextID, err := state.customID(leaderboardNext)
+	if err != nil {
+		return nil, nil, err
+	}
+	components := []discord.MessageComponent{
+		discord.ActionsRow{
+			Components: []discord.MessageComponent{
+				discord.Button{
+					Label:    "Previous",
+					Style:    discord.SecondaryButton,
+					CustomID: prevID,
+					Disabled: state.page <= 1,
+				},
+				discord.Button{
+					Label:    "Next",
+					Style:    discord.SecondaryButton,
+					CustomID: nextID,
+					Disabled: state.page >= pages,
+				},
+			},
+		},
+	}
+	return embeds, components, nil
+}
+
+func (b *Bot) leaderboardEmbed(entries []*leaderboardEntry, by string, page int, title string, period string) ([]*discord.MessageEmbed, error) {
+	pages := leaderboardPages(entries)
+	if page < 1 || page > pages {
+		return nil, fmt.Errorf("page %v doesn't exist (there's %v)", page, pages)
+	}
+	start := (page - 1) * leaderboardPageSize
+	end := min(start+leaderboardPageSize, len(entries))
+
+	lines := []string{}
+	for i, entry := range entries[start:end] {
+		account := entry.account
+		line := fmt.Sprintf("**%v.** <@%v> (%v#%v)", start+i+1, entry.userID, account.Name, account.Discrim)
+		switch by {
+		case sortLP:
+			line += fmt.Sprintf(" — %+d LP %v", entry.gained, period)
+		case sortWinrate:
+			line += fmt.Sprintf(" — %v%% winrate", int(account.Winrate()))
+		case sortGames:
+			line += fmt.Sprintf(" — %v games", entry.games())
+		default:
+			if account.Ranked() {
+				line += fmt.Sprintf(" — %v / %v LP", account.Rank, account.Points)
+			} else {
+				line += fmt.Sprintf(" — %v", account.Rank)
+			}
+		}
+		lines = append(lines, line)
+	}
+	desc := strings.Join(lines, "\n")
+	if len(lines) == 0 {
+		desc = "Nobody has linked an account yet. Use `/link` to get on the board!"
+	}
+
+	return []*discord.MessageEmbed{
+		{
+			Color:       0xF7F12F,
+			Title:       title,
+			Description: desc,
+			Footer: &discord.MessageEmbedFooter{
+				Text: fmt.Sprintf("Page %v/%v • Sorted by %v", page, pages, by),
+			},
+		},
+	}, nil
+}
+
+func (b *Bot) onLeaderboard(i *discord.InteractionCreate) {
+	state := leaderboardState{sort: sortRank, page: 1}
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Name == "sort" {
+			state.sort = opt.StringValue()
+		}
+	}
+
+	// Acknowledge the interaction first
+	b.session.InteractionRespond(i.Interaction, &discord.InteractionResponse{
+		Type: discord.InteractionResponseDeferredChannelMessageWithSource,
+	})
+
+	lk := b.newLookup(statsOptions{guild: i.GuildID})
+	embeds, components, err := b.leaderboardMessage(i.GuildID, state, lk)
+	if err != nil {
+		b.log.Printf("Error building leaderboard: %v", err)
+		errString := fmt.Sprintf(":warning: Failed with error: %v", err)
+		if _, err := b.session.InteractionResponseEdit(i.Interaction, &discord.WebhookEdit{
+			Content: &errString,
+		}); err != nil {
+			b.log.Printf("Error sending error replying to message: %v", err)
+		}
+	} else {
+		lk.mark(embeds)
+		if _, err := b.session.InteractionResponseEdit(i.Interaction, &discord.WebhookEdit{
+			Embeds:     &embeds,
+			Components: &components,
+		}); err != nil {
+			b.log.Printf("Error sending reply to message: %v", err)
+		}
+	}
+}
+
+// Handles the page buttons on a leaderboard message
+func (b *Bot) onLeaderboardComponent(i *discord.InteractionCreate) {
+	action, state, err := parseLeaderboardID(i.MessageComponentData().CustomID)
+	if err != nil {
+		b.log.Printf("Error handling leaderboard component: %v", err)
+		return
+	}
+	switch action {
+	case leaderboardPrev:
+		state.page--
+	case leaderboardNext:
+		state.page++
+	default:
+		b.log.Printf("Leaderboard action not recognized: %v", action)
+		return
+	}
+	// Acknowledge the interaction first, the message gets edited in place
+	b.session.InteractionRespond(i.Interaction, &discord.InteractionResponse{
+		Type: discord.InteractionResponseDeferredMessageUpdate,
+	})
+	lk := b.newLookup(statsOptions{guild: i.GuildID})
+	embeds, components, err := b.leaderboardMessage(i.GuildID, state, lk)
+	if err != nil {
+		b.log.Printf("Error building leaderboard: %v", err)
+		errString := fmt.Sprintf(":warning: Failed with error: %v", err)
+		if _, err := b.session.FollowupMessageCreate(i.Interaction, false, &discord.WebhookParams{
+			Content: errString,
+			Flags:   discord.MessageFlagsEphemeral,
+		}); err != nil {
+			b.log.Printf("Error sending error replying to message: %v", err)
+		}
+		return
+	}
+	lk.mark(embeds)
+	if _, err := b.session.InteractionResponseEdit(i.Interaction, &discord.WebhookEdit{
+		Embeds:     &embeds,
+		Components: &components,
+	}); err != nil {
+		b.log.Printf("Error sending reply to message: %v", err)
+	}
+}
+
+// When the leaderboard for the week that now is in goes out. That's midnight on Monday in the server's
+// time zone, except LP weeks are counted in UTC, so it also waits for the UTC week to start.
+func leaderboardPostTime(now time.Time, loc *time.Location) time.Time {
+	local := now.In(loc)
+	daysSinceMonday := (int(local.Weekday()) + 6) % 7
+	monday := time.Date(local.Year(), local.Month(), local.Day()-daysSinceMonday, 0, 0, 0, 0, loc)
+	// Any time on Monday in the server's time zone is in the UTC week that starts that Monday or the day after
+	utcMonday := weekStart(monday.Add(24 * time.Hour))
+	if monday.Before(utcMonday) {
+		return utcMonday
+	}
+	return monday
+}
+
+// Runs whenever the leaderboard job goes off, then schedules next week's
+func (s *Server) leaderboardTick() {
+	s.mu.Lock()
+	stopped := s.stopped
+	s.mu.Unlock()
+	if stopped {
+		return
+	}
+	s.bot.WeeklyLeaderboard(s)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.armLeaderboard(time.Now())
+}
+
+// Posts last week's leaderboard to the update channel, once a week if the server turned it on
+func (b *Bot) WeeklyLeaderboard(server *Server) {
+	channel, ok := server.leaderboardDue(time.Now())
+	if !ok {
+		// Turned off, or already posted this week
+		return
+	}
+
+	lk := b.newLookup(statsOptions{priority: riot.PriorityBackground, guild: server.guild.ID})
+	entries, err := b.leaderboardEntries(server, true, lk)
+	if err != nil {
+		b.log.Printf("Couldn't get weekly leaderboard for server %v: %v", server.guild.ID, err)
+		return
+	}
+	sortLeaderboard(entries, sortLP)
+	embeds, err := b.leaderboardEmbed(entries, sortLP, 1, "Last week's leaderboard", "last week")
+	if err != nil {
+		b.log.Printf("Couldn't get weekly leaderboard for server %v: %v", server.guild.ID, err)
+		return
+	}
+	lk.mark(embeds)
+	if _, err := b.session.ChannelMessageSendEmbeds(channel.ID, embeds); err != nil {
+		b.log.Printf("Error sending weekly leaderboard to server %v: %v", server.guild.ID, err)
+		return
+	}
+	server.setLeaderboardPosted(time.Now())
+	// Otherwise a restart would post it again
+	if err := server.Save(); err != nil {
+		b.log.Printf("Couldn't save server %v after weekly leaderboard: %v", server.guild.ID, err)
+	}
+}
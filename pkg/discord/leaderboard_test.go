@@ -0,0 +1,128 @@
+package discord
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	discord "github.com/bwmarrin/discordgo"
+	"github.com/thatliuser/simipangpang/pkg/riot"
+)
+
+func TestLeaderboardPostTime(t *testing.T) {
+	mustLoad := func(name string) *time.Location {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return loc
+	}
+	la, tokyo := mustLoad("America/Los_Angeles"), mustLoad("Asia/Tokyo")
+
+	for _, test := range []struct {
+		name string
+		now  time.Time
+		loc  *time.Location
+		want time.Time
+	}{
+		{
+			name: "utc midweek",
+			now:  time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC),
+			loc:  time.UTC,
+			want: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "behind utc goes out at local midnight",
+			now:  time.Date(2024, 3, 13, 12, 0, 0, 0, la),
+			loc:  la,
+			want: time.Date(2024, 3, 11, 0, 0, 0, 0, la),
+		},
+		{
+			name: "ahead of utc waits for the utc week",
+			now:  time.Date(2024, 3, 13, 12, 0, 0, 0, tokyo),
+			loc:  tokyo,
+			want: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "sunday is still last week",
+			now:  time.Date(2024, 3, 17, 23, 0, 0, 0, la),
+			loc:  la,
+			want: time.Date(2024, 3, 11, 0, 0, 0, 0, la),
+		},
+	} {
+		if got := leaderboardPostTime(test.now, test.loc); !got.Equal(test.want) {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLeaderboardPages(t *testing.T) {
+	client := sampleClient()
+	b, fake := newFakeDiscordBot(t, client)
+	fake.addChannel("channel", "guild")
+	server, err := b.ServerFor("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough for a second page with two on it
+	for n := 0; n < leaderboardPageSize+2; n++ {
+		puuid := fmt.Sprintf("puuid-%02d", n)
+		client.Accounts[puuid] = &riot.Account{Name: fmt.Sprintf("player%02d", n), Discrim: "NA1", PUUID: puuid, Rank: "Unranked", Wins: int32(n)}
+		server.Link(fmt.Sprintf("user-%02d", n), puuid)
+	}
+
+	tests := []struct {
+		name string
+		page int
+		// What page should actually show up
+		want    int
+		entries int
+		prevOff bool
+		nextOff bool
+	}{
+		{"first page", 1, 1, leaderboardPageSize, true, false},
+		{"last page", 2, 2, 2, false, true},
+		// Someone could've unlinked since the buttons went out
+		{"past the end", 5, 2, 2, false, true},
+		{"before the start", 0, 1, leaderboardPageSize, true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lk := b.newLookup(statsOptions{guild: "guild"})
+			embeds, components, err := b.leaderboardMessage("guild", leaderboardState{sort: sortGames, page: test.page}, lk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := fmt.Sprintf("Page %v/2 • Sorted by games", test.want); embeds[0].Footer.Text != want {
+				t.Errorf("got footer %q, want %q", embeds[0].Footer.Text, want)
+			}
+			if lines := strings.Split(embeds[0].Description, "\n"); len(lines) != test.entries {
+				t.Errorf("got %v entries, want %v", len(lines), test.entries)
+			}
+
+			buttons := components[0].(discord.ActionsRow).Components
+			prev, next := buttons[0].(discord.Button), buttons[1].(discord.Button)
+			if prev.Disabled != test.prevOff || next.Disabled != test.nextOff {
+				t.Errorf("got previous disabled %v and next disabled %v, want %v and %v", prev.Disabled, next.Disabled, test.prevOff, test.nextOff)
+			}
+			// The buttons remember where they are, so clicking them goes from the page that's showing
+			for _, button := range []struct {
+				customID string
+				action   string
+			}{{prev.CustomID, leaderboardPrev}, {next.CustomID, leaderboardNext}} {
+				action, state, err := parseLeaderboardID(button.customID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if action != button.action || state.sort != sortGames || state.page != test.want {
+					t.Errorf("got %v %+v from custom id %v, want %v on page %v", action, state, button.customID, button.action, test.want)
+				}
+			}
+		})
+	}
+
+	if _, _, err := parseLeaderboardID("h:p:puuid:ranked:week:1"); err == nil {
+		t.Error("parsed a history custom id as a leaderboard one")
+	}
+}
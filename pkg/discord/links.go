@@ -0,0 +1,263 @@
+// Linking Discord users to their Riot accounts. To prove the account is theirs, they have to
+// switch to a profile icon we pick and run /link again.
+
+package discord
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	discord "github.com/bwmarrin/discordgo"
+	"github.com/thatliuser/simipangpang/pkg/riot"
+)
+
+// How long someone has to change their icon
+const linkTimeout = 10 * time.Minute
+
+// Every account has icons 0 through 28, so any of them can be used for verification
+const starterIcons = 29
+
+type pendingLink struct {
+	PUUID   string
+	IconID  int32
+	Expires time.Time
+}
+
+// Accepts name#tag
+func parseRiotID(riotID string) (string, string, error) {
+	name, tag, ok := strings.Cut(strings.TrimSpace(riotID), "#")
+	if !ok || name == "" || tag == "" {
+		return "", "", fmt.Errorf("riot id %v isn't in the form name#tag", riotID)
+	}
+	return name, tag, nil
+}
+
+func (s *Server) LinkFor(userID string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	puuid, ok := s.links[userID]
+	return puuid, ok
+}
+
+// Copy of every link, by Discord user ID
+func (s *Server) Links() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	links := make(map[string]string, len(s.links))
+	for userID, puuid := range s.links {
+		links[userID] = puuid
+	}
+	return links
+}
+
+// Whether anyone in the server is linked to the player
+func (s *Server) HasLinkTo(puuid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, linked := range s.links {
+		if linked == puuid {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) Link(userID string, puuid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links[userID] = puuid
+	delete(s.pending, userID)
+	s.log.Printf("Linked user %v to %v in server %v", userID, puuid, s.guild.ID)
+}
+
+func (s *Server) pendingLink(userID string) (pendingLink, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending, ok := s.pending[userID]
+	return pending, ok
+}
+
+func (s *Server) setPendingLink(userID string, pending pendingLink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[userID] = pending
+}
+
+func (s *Server) Unlink(userID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links[userID]; !ok {
+		return false
+	}
+	delete(s.links, userID)
+	s.log.Printf("Unlinked user %v in server %v", userID, s.guild.ID)
+	return true
+}
+
+// PUUID linked to the user in the guild, if there is one
+func (b *Bot) linkedPUUID(guildID string, userID string) (string, bool) {
+	if guildID == "" {
+		// DMs don't have a server
+		return "", false
+	}
+	server, err := b.ServerFor(guildID)
+	if err != nil {
+		b.log.Printf("Couldn't get server for guild id %v: %v", guildID, err)
+		return "", false
+	}
+	return server.LinkFor(userID)
+}
+
+// The user that ran the interaction. DMs have User set, servers have Member set.
+func interactionUser(i *discord.InteractionCreate) *discord.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// Who the stats are for: the player or user passed in if there is one, otherwise whoever ran the command.
+// An empty PUUID means the default player.
+func (b *Bot) playerFor(i *discord.InteractionCreate, userID string, player string) (string, error) {
+	if userID != "" && player != "" {
+		return "", fmt.Errorf("pass either a user or a player, not both")
+	}
+	if player != "" {
+		return b.resolvePlayer(i.GuildID, player)
+	}
+	if userID != "" {
+		puuid, ok := b.linkedPUUID(i.GuildID, userID)
+		if !ok {
+			return "", fmt.Errorf("<@%v> hasn't linked a Riot account in this server", userID)
+		}
+		return puuid, nil
+	}
+	if user := interactionUser(i); user != nil {
+		if puuid, ok := b.linkedPUUID(i.GuildID, user.ID); ok {
+			return puuid, nil
+		}
+	}
+	return "", nil
+}
+
+// Shared by the link commands since they only reply to the person that ran them
+func (b *Bot) respondEphemeral(i *discord.InteractionCreate, respond func() (string, []*discord.MessageEmbed, error)) {
+	// Acknowledge the interaction first since Riot might take a while
+	b.session.InteractionRespond(i.Interaction, &discord.InteractionResponse{
+		Type: discord.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discord.InteractionResponseData{
+			Flags: discord.MessageFlagsEphemeral,
+		},
+	})
+
+	content, embeds, err := respond()
+	if err != nil {
+		content = fmt.Sprintf(":warning: Failed with error: %v", err)
+		embeds = []*discord.MessageEmbed{}
+	}
+	if _, err := b.session.InteractionResponseEdit(i.Interaction, &discord.WebhookEdit{
+		Content: &content,
+		Embeds:  &embeds,
+	}); err != nil {
+		b.log.Printf("Error sending reply to message: %v", err)
+	}
+}
+
+func (b *Bot) linkFromRiotID(guildID string, user *discord.User, riotID string) (string, []*discord.MessageEmbed, error) {
+	if guildID == "" {
+		return "", nil, fmt.Errorf("accounts can only be linked in servers")
+	}
+	name, tag, err := parseRiotID(riotID)
+	if err != nil {
+		return "", nil, err
+	}
+	server, err := b.ServerFor(guildID)
+	if err != nil {
+		return "", nil, fmt.Errorf("couldn't get server for guild id %v: %v", guildID, err)
+	}
+	// A cached summoner would still have the old icon
+	client := b.client.Prioritized(riot.PriorityInteractive, guildID).Uncached()
+	account, err := client.AccountByRiotID(name, tag)
+	if err != nil {
+		return "", nil, err
+	}
+
+	pending, ok := server.pendingLink(user.ID)
+	if ok && pending.PUUID == account.PUUID && time.Now().Before(pending.Expires) {
+		if account.IconID != pending.IconID {
+			return fmt.Sprintf(
+				"Your profile icon isn't the one below yet. Change it and run `/link` again <t:%v:R>.",
+				pending.Expires.Unix(),
+			), b.linkIconEmbed(pending.IconID), nil
+		}
+		server.Link(user.ID, account.PUUID)
+		if err := server.Save(); err != nil {
+			b.log.Printf("Couldn't save server %v after linking: %v", guildID, err)
+		}
+		if _, err := b.track(account); err != nil {
+			b.log.Printf("Couldn't save tracked account %v: %v", account.PUUID, err)
+		}
+		return fmt.Sprintf("Linked to **%v#%v**! You can change your icon back now.", account.Name, account.Discrim), nil, nil
+	}
+
+	// Pick an icon they're not already using
+	icon := rand.Int31n(starterIcons - 1)
+	if icon >= account.IconID {
+		icon++
+	}
+	server.setPendingLink(user.ID, pendingLink{
+		PUUID:   account.PUUID,
+		IconID:  icon,
+		Expires: time.Now().Add(linkTimeout),
+	})
+	return fmt.Sprintf(
+		"To prove **%v#%v** is yours, change your profile icon to the one below, then run `/link` again <t:%v:R>.",
+		account.Name, account.Discrim, time.Now().Add(linkTimeout).Unix(),
+	), b.linkIconEmbed(icon), nil
+}
+
+func (b *Bot) linkIconEmbed(icon int32) []*discord.MessageEmbed {
+	return []*discord.MessageEmbed{
+		{
+			Color: 0xF7F12F,
+			Image: &discord.MessageEmbedImage{
+				URL: b.client.IconURLForProfileIcon(icon),
+			},
+			Footer: &discord.MessageEmbedFooter{
+				Text: fmt.Sprintf("Profile icon %v", icon),
+			},
+		},
+	}
+}
+
+func (b *Bot) onLink(i *discord.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	if len(options) != 1 {
+		// Don't respond so it errors
+		return
+	}
+	b.respondEphemeral(i, func() (string, []*discord.MessageEmbed, error) {
+		return b.linkFromRiotID(i.GuildID, interactionUser(i), options[0].StringValue())
+	})
+}
+
+func (b *Bot) onUnlink(i *discord.InteractionCreate) {
+	b.respondEphemeral(i, func() (string, []*discord.MessageEmbed, error) {
+		if i.GuildID == "" {
+			return "", nil, fmt.Errorf("accounts can only be linked in servers")
+		}
+		server, err := b.ServerFor(i.GuildID)
+		if err != nil {
+			return "", nil, fmt.Errorf("couldn't get server for guild id %v: %v", i.GuildID, err)
+		}
+		if !server.Unlink(interactionUser(i).ID) {
+			return "You don't have a linked account in this server", nil, nil
+		}
+		if err := server.Save(); err != nil {
+			b.log.Printf("Couldn't save server %v after unlinking: %v", i.GuildID, err)
+		}
+		return "Unlinked your account", nil, nil
+	})
+}
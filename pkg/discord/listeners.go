@@ -4,7 +4,9 @@ package discord
 import (
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/Kyagara/equinox/clients/ddragon"
 	discord "github.com/bwmarrin/discordgo"
 	"github.com/thatliuser/simipangpang/pkg/riot"
 )
@@ -58,6 +60,109 @@ func (b *Bot) updatePeriodFromVerb(server *Server, verb string, opts ...int64) (
 	}
 }
 
+func (b *Bot) updateLanguageFromVerb(server *Server, verb string, opts ...string) (string, error) {
+	switch verb {
+	case "get":
+		return fmt.Sprintf("The current language is %v", server.GetLanguage()), nil
+	case "set":
+		if len(opts) != 1 {
+			return "", fmt.Errorf("didn't pass a language to be set")
+		}
+
+		if err := server.SetLanguage(opts[0]); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Success! The new language is %v", server.GetLanguage()), nil
+	case "reset":
+		server.ResetLanguage()
+		return "Success! The language has been reset", nil
+	default:
+		return "", fmt.Errorf("didn't pass a valid verb to the update language command (%v)", verb)
+	}
+}
+
+func (b *Bot) updateLeaderboardFromVerb(server *Server, verb string, opts ...bool) (string, error) {
+	switch verb {
+	case "get":
+		return fmt.Sprintf("The weekly leaderboard is %v", server.GetWeeklyLeaderboard()), nil
+	case "set":
+		if len(opts) != 1 {
+			return "", fmt.Errorf("didn't pass whether to post the weekly leaderboard")
+		}
+
+		server.SetWeeklyLeaderboard(opts[0])
+		return fmt.Sprintf("Success! The weekly leaderboard is now %v", server.GetWeeklyLeaderboard()), nil
+	case "reset":
+		server.SetWeeklyLeaderboard(false)
+		return "Success! The weekly leaderboard has been reset", nil
+	default:
+		return "", fmt.Errorf("didn't pass a valid verb to the update leaderboard command (%v)", verb)
+	}
+}
+
+func (b *Bot) updateScheduleFromVerb(server *Server, verb string, opts ...string) (string, error) {
+	switch verb {
+	case "get":
+		return fmt.Sprintf("The current update schedule is %v", server.GetSchedule()), nil
+	case "set":
+		if len(opts) != 1 {
+			return "", fmt.Errorf("didn't pass a schedule to be set")
+		}
+
+		if err := server.SetSchedule(opts[0]); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Success! The new update schedule is %v", server.GetSchedule()), nil
+	case "reset":
+		server.ResetSchedule()
+		return "Success! The update schedule has been reset", nil
+	default:
+		return "", fmt.Errorf("didn't pass a valid verb to the update schedule command (%v)", verb)
+	}
+}
+
+func (b *Bot) updateTimezoneFromVerb(server *Server, verb string, opts ...string) (string, error) {
+	switch verb {
+	case "get":
+		return fmt.Sprintf("The current time zone is %v", server.GetTimezone()), nil
+	case "set":
+		if len(opts) != 1 {
+			return "", fmt.Errorf("didn't pass a time zone to be set")
+		}
+
+		if err := server.SetTimezone(opts[0]); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Success! The new time zone is %v", server.GetTimezone()), nil
+	case "reset":
+		server.ResetTimezone()
+		return "Success! The time zone has been reset", nil
+	default:
+		return "", fmt.Errorf("didn't pass a valid verb to the update timezone command (%v)", verb)
+	}
+}
+
+func (b *Bot) updateCatchUpFromVerb(server *Server, verb string, opts ...string) (string, error) {
+	switch verb {
+	case "get":
+		return fmt.Sprintf("The current catch up policy is %v", server.GetCatchUp()), nil
+	case "set":
+		if len(opts) != 1 {
+			return "", fmt.Errorf("didn't pass a catch up policy to be set")
+		}
+
+		if err := server.SetCatchUp(opts[0]); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Success! The new catch up policy is %v", server.GetCatchUp()), nil
+	case "reset":
+		server.ResetCatchUp()
+		return "Success! The catch up policy has been reset", nil
+	default:
+		return "", fmt.Errorf("didn't pass a valid verb to the update catchup command (%v)", verb)
+	}
+}
+
 func (b *Bot) updateSettingFromVerb(guildID string, setting string, verb string, opts ...*discord.ApplicationCommandInteractionDataOption) (string, error) {
 	server, err := b.ServerFor(guildID)
 	if err != nil {
@@ -77,6 +182,36 @@ func (b *Bot) updateSettingFromVerb(guildID string, setting string, verb string,
 			periods = append(periods, opt.IntValue())
 		}
 		return b.updatePeriodFromVerb(server, verb, periods...)
+	case "language":
+		langs := []string{}
+		for _, opt := range opts {
+			langs = append(langs, opt.StringValue())
+		}
+		return b.updateLanguageFromVerb(server, verb, langs...)
+	case "leaderboard":
+		enabled := []bool{}
+		for _, opt := range opts {
+			enabled = append(enabled, opt.BoolValue())
+		}
+		return b.updateLeaderboardFromVerb(server, verb, enabled...)
+	case "schedule":
+		specs := []string{}
+		for _, opt := range opts {
+			specs = append(specs, opt.StringValue())
+		}
+		return b.updateScheduleFromVerb(server, verb, specs...)
+	case "timezone":
+		zones := []string{}
+		for _, opt := range opts {
+			zones = append(zones, opt.StringValue())
+		}
+		return b.updateTimezoneFromVerb(server, verb, zones...)
+	case "catchup":
+		policies := []string{}
+		for _, opt := range opts {
+			policies = append(policies, opt.StringValue())
+		}
+		return b.updateCatchUpFromVerb(server, verb, policies...)
 	default:
 		return "", fmt.Errorf("didn't pass a valid option to the update setting command (%v)", setting)
 	}
@@ -119,38 +254,132 @@ const (
 	discrim = "NA1"
 )
 
-func (b *Bot) embedsFromVerb(verb string) ([]*discord.MessageEmbed, error) {
-	account, err := b.client.AccountByRiotID(name, discrim)
+const (
+	windowWeek  = "week"
+	windowSplit = "split"
+)
+
+// Returns when the window starts and how it should be described in captions
+func (b *Bot) windowStart(window string) (time.Time, string, error) {
+	switch window {
+	case "", windowWeek:
+		// Truncated so lookups that happen around the same time can be shared
+		return time.Now().AddDate(0, 0, -7).Truncate(time.Minute), "this week", nil
+	case windowSplit:
+		split := b.calendar.Current()
+		if split == nil {
+			return time.Time{}, "", fmt.Errorf("there's no ranked split going on right now")
+		}
+		return split.Start, "this split", nil
+	default:
+		return time.Time{}, "", fmt.Errorf("window not recognized: %v", window)
+	}
+}
+
+// Options that can be passed to the stats subcommands
+type statsOptions struct {
+	window string
+	queue  riot.Queue
+	// Not an actual option, comes from the server
+	lang ddragon.Language
+	// Not options either, these decide how soon the Riot requests go out
+	priority riot.Priority
+	guild    string
+	// Discord user the stats are for, if one was passed
+	user string
+	// Riot ID, mention or tracked name, if one was passed
+	player string
+	// Who the stats end up being for. Empty means the default player.
+	puuid string
+}
+
+func statsOptionsFrom(opts []*discord.ApplicationCommandInteractionDataOption, lang ddragon.Language) (statsOptions, error) {
+	options := statsOptions{
+		window: windowWeek,
+		queue:  riot.QueueRanked,
+		lang:   lang,
+	}
+	for _, opt := range opts {
+		switch opt.Name {
+		case "window":
+			options.window = opt.StringValue()
+		case "queue":
+			queue, err := riot.ParseQueue(opt.StringValue())
+			if err != nil {
+				return options, err
+			}
+			options.queue = queue
+		case "user":
+			// The session is only needed to fill in the rest of the user
+			options.user = opt.UserValue(nil).ID
+		case "player":
+			options.player = opt.StringValue()
+		}
+	}
+	return options, nil
+}
+
+func (b *Bot) embedsFromVerb(verb string, opts statsOptions) ([]*discord.MessageEmbed, error) {
+	// We only need the account for this one so don't bother validating the window
+	if verb == "short" {
+		return b.embedsSince(verb, time.Time{}, "", opts)
+	}
+	since, desc, err := b.windowStart(opts.window)
+	if err != nil {
+		return nil, err
+	}
+	return b.embedsSince(verb, since, desc, opts)
+}
+
+// Ignores opts.window in favor of since
+func (b *Bot) embedsSince(verb string, since time.Time, window string, opts statsOptions) ([]*discord.MessageEmbed, error) {
+	queue, lang := opts.queue, opts.lang
+	lk := b.newLookup(opts)
+	account, err := b.accountFor(opts, lk)
 	if err != nil {
 		return nil, err
 	}
 	// We only need the account for this one
 	if verb == "short" {
-		return b.shortEmbed(account)
+		embeds, err := b.shortEmbed(account, lang, lk)
+		if err != nil {
+			return nil, err
+		}
+		lk.mark(embeds)
+		return embeds, nil
 	}
 
-	matches, err := b.matchesByPerformance(account)
+	matches, err := b.matchesByPerformance(account, queue, since, lk)
 	if err != nil {
 		return nil, err
 	}
+	desc := fmt.Sprintf("%v match %v", queue.Name(), window)
 
 	// Who needs clean code??? What is that even???
-	embedFunc := (func(*riot.Account, []*riot.Match) ([]*discord.MessageEmbed, error))(nil)
+	embedFunc := (func(*riot.Account, []*riot.Match, string, ddragon.Language) ([]*discord.MessageEmbed, error))(nil)
 	switch verb {
 	case "best":
 		embedFunc = b.bestMatchEmbed
 	case "worst":
 		embedFunc = b.worstMatchEmbed
 	case "all":
-		embedFunc = b.allEmbed
+		embedFunc = func(account *riot.Account, matches []*riot.Match, desc string, lang ddragon.Language) ([]*discord.MessageEmbed, error) {
+			return b.allEmbed(account, matches, desc, lang, lk)
+		}
 	default:
 		return nil, fmt.Errorf("verb not recognized: %v", verb)
 	}
 
-	return embedFunc(account, matches)
+	embeds, err := embedFunc(account, matches, desc, lang)
+	if err != nil {
+		return nil, err
+	}
+	lk.mark(embeds)
+	return embeds, nil
 }
 
-func (b *Bot) onStats(i *discord.InteractionCreate) {
+// Shared by the stats commands since they all take a while to get embeds for
+func (b *Bot) respondWithEmbeds(i *discord.InteractionCreate, embedsFunc func(verb string, opts statsOptions) ([]*discord.MessageEmbed, error)) {
 	// Validate input format
 	options := i.ApplicationCommandData().Options
 	if len(options) != 1 {
@@ -163,7 +392,16 @@ func (b *Bot) onStats(i *discord.InteractionCreate) {
 		Type: discord.InteractionResponseDeferredChannelMessageWithSource,
 	})
 
-	embeds, err := b.embedsFromVerb(options[0].Name)
+	verb := options[0]
+	opts, err := statsOptionsFrom(verb.Options, b.languageFor(i.GuildID))
+	opts.guild = i.GuildID
+	if err == nil {
+		opts.puuid, err = b.playerFor(i, opts.user, opts.player)
+	}
+	embeds := []*discord.MessageEmbed{}
+	if err == nil {
+		embeds, err = embedsFunc(verb.Name, opts)
+	}
 
 	if err != nil {
 		b.log.Printf("Error retrieving stats for user: %v", err)
@@ -183,19 +421,39 @@ func (b *Bot) onStats(i *discord.InteractionCreate) {
 	}
 }
 
+func (b *Bot) onStats(i *discord.InteractionCreate) {
+	b.respondWithEmbeds(i, b.embedsFromVerb)
+}
+
+func (b *Bot) onTFT(i *discord.InteractionCreate) {
+	b.respondWithEmbeds(i, b.tftEmbedsFromVerb)
+}
+
+// Whether the message mentions the default player, by their original or current name
+func (b *Bot) mentionsTracked(content string) bool {
+	content = strings.ToLower(content)
+	if strings.Contains(content, name) {
+		return true
+	}
+	b.tracked.mu.Lock()
+	defer b.tracked.mu.Unlock()
+	tracked, ok := b.tracked.state.Accounts[b.tracked.state.Default]
+	return ok && strings.Contains(content, strings.ToLower(tracked.Name))
+}
+
 func (b *Bot) onMessage(_ *discord.Session, m *discord.MessageCreate) {
 	// Ignore messages sent by ourselves
 	if m.Author.ID == b.session.State.User.ID {
 		return
 	}
 
-	if !strings.Contains(strings.ToLower(m.Content), name) {
+	if !b.mentionsTracked(m.Content) {
 		return
 	}
 
 	b.log.Printf("Got message '%v' from %v", m.Content, m.Author.Username)
 
-	embeds, err := b.embedsFromVerb("short")
+	embeds, err := b.embedsFromVerb("short", statsOptions{lang: b.languageFor(m.GuildID), guild: m.GuildID})
 	if err != nil {
 		b.log.Printf("Error retrieving stats for user: %v", err)
 	} else {
@@ -238,28 +496,85 @@ func newUpdateSetting(name string, descName string, varType discord.ApplicationC
 	}
 }
 
+func newWindowOption() *discord.ApplicationCommandOption {
+	return &discord.ApplicationCommandOption{
+		Name:        "window",
+		Description: "How far back to look for matches (defaults to the last week)",
+		Type:        discord.ApplicationCommandOptionString,
+		Choices: []*discord.ApplicationCommandOptionChoice{
+			{
+				Name:  "This week",
+				Value: windowWeek,
+			},
+			{
+				Name:  "This split",
+				Value: windowSplit,
+			},
+		},
+	}
+}
+
+func newQueueOption() *discord.ApplicationCommandOption {
+	return &discord.ApplicationCommandOption{
+		Name:        "queue",
+		Description: "Which queue to look for matches in (defaults to ranked)",
+		Type:        discord.ApplicationCommandOptionString,
+		Choices: []*discord.ApplicationCommandOptionChoice{
+			{
+				Name:  "Ranked",
+				Value: riot.QueueRanked,
+			},
+			{
+				Name:  "Normal",
+				Value: riot.QueueNormal,
+			},
+			{
+				Name:  "ARAM",
+				Value: riot.QueueARAM,
+			},
+			{
+				Name:  "Arena",
+				Value: riot.QueueArena,
+			},
+		},
+	}
+}
+
+func newUserOption() *discord.ApplicationCommandOption {
+	return &discord.ApplicationCommandOption{
+		Name:        "user",
+		Description: "Member to get stats for, if they've linked an account (defaults to you)",
+		Type:        discord.ApplicationCommandOptionUser,
+	}
+}
+
 // Actually add the functionality to the bot
 func (b *Bot) addListeners() error {
 	manage := int64(discord.PermissionManageServer)
 	// This is declared locally because you should only call this once on init
-	type Handler func(*discord.InteractionCreate)
-
 	type Command struct {
 		command *discord.ApplicationCommand
-		handler Handler
+		handler handler
+		// Only for commands with options that autocomplete
+		autocomplete handler
 	}
 
 	commands := []Command{
 		{
 			command: &discord.ApplicationCommand{
 				Name:        "update",
-				Description: "Set or get the update channel for the server",
+				Description: "Set or get update settings (channel, period, language, leaderboard, schedule, timezone, catch-up)",
 				Type:        discord.ChatApplicationCommand,
 				// WTF is the point of making this a pointer
 				DefaultMemberPermissions: &manage,
 				Options: []*discord.ApplicationCommandOption{
 					newUpdateSetting("channel", "update channel", discord.ApplicationCommandOptionChannel),
 					newUpdateSetting("period", "update period (in minutes)", discord.ApplicationCommandOptionInteger),
+					newUpdateSetting("language", "language for champion names (like en_US)", discord.ApplicationCommandOptionString),
+					newUpdateSetting("leaderboard", "weekly leaderboard post", discord.ApplicationCommandOptionBoolean),
+					newUpdateSetting("schedule", "update schedule (cron, or like \"daily at 20:00\")", discord.ApplicationCommandOptionString),
+					newUpdateSetting("timezone", "time zone for the update schedule (like America/Los_Angeles)", discord.ApplicationCommandOptionString),
+					newUpdateSetting("catchup", "policy for updates missed while the bot was down (run or skip)", discord.ApplicationCommandOptionString),
 				},
 			},
 			handler: b.onUpdateConfig,
@@ -267,51 +582,217 @@ func (b *Bot) addListeners() error {
 		{
 			command: &discord.ApplicationCommand{
 				Name:        "stats",
-				Description: "Get simipangpang's stats",
+				Description: "Get your stats once you've linked an account (or simipangpang's)",
 				Type:        discord.ChatApplicationCommand,
 				Options: []*discord.ApplicationCommandOption{
 					{
 						Name:        "short",
 						Description: "Get a stats summary",
 						Type:        discord.ApplicationCommandOptionSubCommand,
+						Options: []*discord.ApplicationCommandOption{
+							newUserOption(),
+							newPlayerOption(),
+						},
 					},
 					{
 						Name:        "best",
-						Description: "Get the best match for the week",
+						Description: "Get the best match in a time window",
 						Type:        discord.ApplicationCommandOptionSubCommand,
+						Options: []*discord.ApplicationCommandOption{
+							newWindowOption(),
+							newQueueOption(),
+							newUserOption(),
+							newPlayerOption(),
+						},
 					},
 					{
 						Name:        "worst",
-						Description: "Get the worst match for the week",
+						Description: "Get the worst match in a time window",
 						Type:        discord.ApplicationCommandOptionSubCommand,
+						Options: []*discord.ApplicationCommandOption{
+							newWindowOption(),
+							newQueueOption(),
+							newUserOption(),
+							newPlayerOption(),
+						},
 					},
 					{
 						Name:        "all",
 						Description: "Get all available stats",
 						Type:        discord.ApplicationCommandOptionSubCommand,
+						Options: []*discord.ApplicationCommandOption{
+							newWindowOption(),
+							newQueueOption(),
+							newUserOption(),
+							newPlayerOption(),
+						},
+					},
+				},
+			},
+			handler:      b.onStats,
+			autocomplete: b.onPlayerAutocomplete,
+		},
+		{
+			command: &discord.ApplicationCommand{
+				Name:        "tft",
+				Description: "Get your TFT stats once you've linked an account (or simipangpang's)",
+				Type:        discord.ChatApplicationCommand,
+				Options: []*discord.ApplicationCommandOption{
+					{
+						Name:        "short",
+						Description: "Get a TFT stats summary",
+						Type:        discord.ApplicationCommandOptionSubCommand,
+						Options: []*discord.ApplicationCommandOption{
+							newWindowOption(),
+							newUserOption(),
+						},
+					},
+					{
+						Name:        "best",
+						Description: "Get the best TFT match in a time window",
+						Type:        discord.ApplicationCommandOptionSubCommand,
+						Options: []*discord.ApplicationCommandOption{
+							newWindowOption(),
+							newUserOption(),
+						},
+					},
+					{
+						Name:        "worst",
+						Description: "Get the worst TFT match in a time window",
+						Type:        discord.ApplicationCommandOptionSubCommand,
+						Options: []*discord.ApplicationCommandOption{
+							newWindowOption(),
+							newUserOption(),
+						},
 					},
 				},
 			},
-			handler: b.onStats,
+			handler: b.onTFT,
+		},
+		{
+			command: &discord.ApplicationCommand{
+				Name:        "riotkey",
+				Description: "Change the Riot API key (owner only)",
+				Type:        discord.ChatApplicationCommand,
+				Options: []*discord.ApplicationCommandOption{
+					{
+						Name:        "set",
+						Description: "Use a new Riot API key",
+						Type:        discord.ApplicationCommandOptionSubCommand,
+						Options: []*discord.ApplicationCommandOption{
+							{
+								Name:        "key",
+								Description: "The new key (separate several with commas)",
+								Type:        discord.ApplicationCommandOptionString,
+								Required:    true,
+							},
+						},
+					},
+					{
+						Name:        "reload",
+						Description: "Reload the Riot API key from the token file or environment",
+						Type:        discord.ApplicationCommandOptionSubCommand,
+					},
+				},
+			},
+			handler: b.onRiotKey,
+		},
+		{
+			command: &discord.ApplicationCommand{
+				Name:        "link",
+				Description: "Link your Riot account so stats default to you",
+				Type:        discord.ChatApplicationCommand,
+				Options: []*discord.ApplicationCommandOption{
+					{
+						Name:        "riot_id",
+						Description: "Your Riot ID, like name#tag",
+						Type:        discord.ApplicationCommandOptionString,
+						Required:    true,
+					},
+				},
+			},
+			handler: b.onLink,
+		},
+		{
+			command: &discord.ApplicationCommand{
+				Name:        "leaderboard",
+				Description: "Rank everyone in the server that's linked an account",
+				Type:        discord.ChatApplicationCommand,
+				Options: []*discord.ApplicationCommandOption{
+					{
+						Name:        "sort",
+						Description: "What to rank by (defaults to rank)",
+						Type:        discord.ApplicationCommandOptionString,
+						Choices: []*discord.ApplicationCommandOptionChoice{
+							{
+								Name:  "Rank",
+								Value: sortRank,
+							},
+							{
+								Name:  "LP gained this week",
+								Value: sortLP,
+							},
+							{
+								Name:  "Winrate",
+								Value: sortWinrate,
+							},
+							{
+								Name:  "Games played",
+								Value: sortGames,
+							},
+						},
+					},
+				},
+			},
+			handler: b.onLeaderboard,
+		},
+		{
+			command: &discord.ApplicationCommand{
+				Name:        "history",
+				Description: "Page through recent matches (yours once you've linked an account, or simipangpang's)",
+				Type:        discord.ChatApplicationCommand,
+				Options: []*discord.ApplicationCommandOption{
+					newWindowOption(),
+					newQueueOption(),
+					newUserOption(),
+					newPlayerOption(),
+				},
+			},
+			handler:      b.onHistory,
+			autocomplete: b.onPlayerAutocomplete,
+		},
+		{
+			command: &discord.ApplicationCommand{
+				Name:        "jobs",
+				Description: "Show upcoming scheduled updates",
+				Type:        discord.ChatApplicationCommand,
+			},
+			handler: b.onJobs,
+		},
+		{
+			command: &discord.ApplicationCommand{
+				Name:        "unlink",
+				Description: "Unlink your Riot account",
+				Type:        discord.ChatApplicationCommand,
+			},
+			handler: b.onUnlink,
 		},
 	}
 
-	handlerMap := make(map[string]Handler)
+	router := newRouter(b.log)
 	for _, c := range commands {
 		if _, err := b.session.ApplicationCommandCreate(b.session.State.User.ID, "", c.command); err != nil {
 			return fmt.Errorf("couldn't register command %v: %v", c.command.Name, err)
 		}
-		handlerMap[c.command.Name] = c.handler
+		router.commands[c.command.Name] = c.handler
+		if c.autocomplete != nil {
+			router.autocomplete[c.command.Name] = c.autocomplete
+		}
 	}
+	router.components[historyPrefix] = b.onHistoryComponent
+	router.components[leaderboardPrefix] = b.onLeaderboardComponent
 
-	b.session.AddHandler(func(_ *discord.Session, i *discord.InteractionCreate) {
-		command := i.ApplicationCommandData().Name
-		if handler, ok := handlerMap[command]; ok {
-			handler(i)
-		} else {
-			b.log.Printf("Passed invalid command name %v", command)
-		}
-	})
+	b.session.AddHandler(router.route)
 	b.session.AddHandler(b.onMessage)
 
 	return nil
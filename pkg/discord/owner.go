@@ -0,0 +1,110 @@
+// Stuff only the bot owner gets to see or do, mostly to do with the Riot API key.
+
+package discord
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+const ownerEnv = "DISCORD_OWNER_ID"
+
+// Only the real Riot client has a key to swap out
+type keySwapper interface {
+	SetKey(keys string) error
+	ReloadKey() error
+}
+
+// Falls back to whoever owns the application if it's not set in the environment
+func (b *Bot) lookupOwner() {
+	if owner, ok := os.LookupEnv(ownerEnv); ok {
+		b.owner = owner
+		return
+	}
+	app, err := b.session.Application("@me")
+	if err != nil {
+		b.log.Printf("Couldn't lookup application owner, owner commands and alerts won't work: %v", err)
+		return
+	}
+	if app.Owner != nil {
+		b.owner = app.Owner.ID
+	}
+}
+
+// Logs the alert and DMs it to the owner, if there is one
+func (b *Bot) AlertOwner(content string) {
+	b.log.Printf("Owner alert: %v", content)
+	if b.owner == "" {
+		return
+	}
+	channel, err := b.session.UserChannelCreate(b.owner)
+	if err != nil {
+		b.log.Printf("Couldn't open DM with owner: %v", err)
+		return
+	}
+	if _, err := b.session.ChannelMessageSend(channel.ID, content); err != nil {
+		b.log.Printf("Couldn't send alert to owner: %v", err)
+	}
+}
+
+// Meant to be passed to riot.Client.OnKeyRejected
+func (b *Bot) RiotKeyRejected(key string, status int, left int) {
+	if left > 0 {
+		b.AlertOwner(fmt.Sprintf(
+			":warning: Riot rejected the API key ending in %v (%v %v), so the other %v will be used instead.",
+			key, status, http.StatusText(status), left,
+		))
+		return
+	}
+	b.AlertOwner(fmt.Sprintf(
+		":warning: Riot rejected the API key ending in %v (%v %v), and there aren't any others left. It probably expired, so set a new one with `/riotkey set`, the token file or SIGHUP.",
+		key, status, http.StatusText(status),
+	))
+}
+
+func (b *Bot) onRiotKey(i *discord.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	if len(options) != 1 {
+		// Don't respond so it errors
+		return
+	}
+	user := interactionUser(i)
+
+	resp := ""
+	swapper, ok := b.client.(keySwapper)
+	switch {
+	case b.owner == "" || user == nil || user.ID != b.owner:
+		resp = ":warning: Only the bot owner can do that"
+	case !ok:
+		resp = ":warning: The Riot client doesn't use a key"
+	case options[0].Name == "set":
+		if err := swapper.SetKey(options[0].Options[0].StringValue()); err != nil {
+			resp = fmt.Sprintf(":warning: Failed with error: %v", err)
+		} else {
+			b.log.Printf("Riot API key was changed by %v", user.Username)
+			resp = "Riot API key changed"
+		}
+	case options[0].Name == "reload":
+		if err := swapper.ReloadKey(); err != nil {
+			resp = fmt.Sprintf(":warning: Failed with error: %v", err)
+		} else {
+			b.log.Printf("Riot API key was reloaded by %v", user.Username)
+			resp = "Riot API key reloaded"
+		}
+	default:
+		resp = fmt.Sprintf(":warning: Subcommand not recognized: %v", options[0].Name)
+	}
+
+	if err := b.session.InteractionRespond(i.Interaction, &discord.InteractionResponse{
+		Type: discord.InteractionResponseChannelMessageWithSource,
+		Data: &discord.InteractionResponseData{
+			Flags:   discord.MessageFlagsEphemeral,
+			Content: resp,
+		},
+	}); err != nil {
+		b.log.Printf("Error sending reply to message: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+// Figuring out who a player option means. It can be a Riot ID, a mention of a linked member,
+// or just the name of someone the bot already tracks.
+
+package discord
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	discord "github.com/bwmarrin/discordgo"
+	"github.com/thatliuser/simipangpang/pkg/riot"
+)
+
+// Discord caps autocomplete at this many choices
+const maxChoices = 25
+
+func newPlayerOption() *discord.ApplicationCommandOption {
+	return &discord.ApplicationCommandOption{
+		Name:         "player",
+		Description:  "Riot ID (name#tag), linked member or tracked player to get stats for",
+		Type:         discord.ApplicationCommandOptionString,
+		Autocomplete: true,
+	}
+}
+
+// Pulls the user ID out of <@id> or <@!id>
+func parseMention(player string) (string, bool) {
+	id, ok := strings.CutPrefix(player, "<@")
+	if !ok {
+		return "", false
+	}
+	id, ok = strings.CutSuffix(strings.TrimPrefix(id, "!"), ">")
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// Tracked accounts that go by the name, either right now or at some point.
+// The tag is optional, and it's case insensitive since that's how Riot treats it.
+func (b *Bot) trackedByName(name string, tag string) []trackedAccount {
+	b.tracked.mu.Lock()
+	defer b.tracked.mu.Unlock()
+	matches := func(otherName string, otherTag string) bool {
+		return strings.EqualFold(name, otherName) && (tag == "" || strings.EqualFold(tag, otherTag))
+	}
+	found := []trackedAccount{}
+	for _, tracked := range b.tracked.state.Accounts {
+		if matches(tracked.Name, tracked.Discrim) {
+			found = append(found, *tracked)
+			continue
+		}
+		for _, change := range tracked.History {
+			if matches(change.Name, change.Discrim) {
+				found = append(found, *tracked)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// Turns the player option into a PUUID
+func (b *Bot) resolvePlayer(guildID string, player string) (string, error) {
+	player = strings.TrimSpace(player)
+	if userID, ok := parseMention(player); ok {
+		puuid, ok := b.linkedPUUID(guildID, userID)
+		if !ok {
+			return "", fmt.Errorf("<@%v> hasn't linked a Riot account in this server", userID)
+		}
+		return puuid, nil
+	}
+
+	name, tag, err := parseRiotID(player)
+	if err != nil {
+		// Not a Riot ID, so it has to be someone we already know about
+		found := b.trackedByName(player, "")
+		switch len(found) {
+		case 0:
+			return "", fmt.Errorf("nobody called %v is tracked, try their full Riot ID (name#tag)", player)
+		case 1:
+			return found[0].PUUID, nil
+		default:
+			return "", fmt.Errorf("more than one tracked player is called %v, use their full Riot ID (name#tag)", player)
+		}
+	}
+	// Saves a request if we already know who it is
+	if found := b.trackedByName(name, tag); len(found) == 1 {
+		return found[0].PUUID, nil
+	}
+	// The stats lookup gets the rest of the account, through snapshots and shared lookups like everything else
+	return b.client.Prioritized(riot.PriorityInteractive, guildID).PUUIDByRiotID(name, tag)
+}
+
+// Players worth suggesting in the guild: everyone linked there, plus the default player
+func (b *Bot) suggestedPlayers(guildID string) []trackedAccount {
+	puuids := []string{}
+	if guildID != "" {
+		if server, err := b.ServerFor(guildID); err == nil {
+			for _, puuid := range server.Links() {
+				puuids = append(puuids, puuid)
+			}
+		}
+	}
+	b.tracked.mu.Lock()
+	if b.tracked.state.Default != "" {
+		puuids = append(puuids, b.tracked.state.Default)
+	}
+	b.tracked.mu.Unlock()
+
+	suggested := []trackedAccount{}
+	for _, puuid := range puuids {
+		tracked, ok := b.trackedByPUUID(puuid)
+		if !ok || slices.ContainsFunc(suggested, func(other trackedAccount) bool { return other.PUUID == puuid }) {
+			continue
+		}
+		suggested = append(suggested, tracked)
+	}
+	slices.SortFunc(suggested, func(one, two trackedAccount) int {
+		return strings.Compare(strings.ToLower(one.RiotID()), strings.ToLower(two.RiotID()))
+	})
+	return suggested
+}
+
+// The option that's being typed in, wherever it is
+func focusedOption(opts []*discord.ApplicationCommandInteractionDataOption) *discord.ApplicationCommandInteractionDataOption {
+	for _, opt := range opts {
+		if opt.Focused {
+			return opt
+		}
+		if focused := focusedOption(opt.Options); focused != nil {
+			return focused
+		}
+	}
+	return nil
+}
+
+func (b *Bot) onPlayerAutocomplete(i *discord.InteractionCreate) {
+	typed := ""
+	if focused := focusedOption(i.ApplicationCommandData().Options); focused != nil && focused.Name == "player" {
+		typed = strings.ToLower(focused.StringValue())
+	}
+
+	choices := []*discord.ApplicationCommandOptionChoice{}
+	for _, tracked := range b.suggestedPlayers(i.GuildID) {
+		if len(choices) == maxChoices {
+			break
+		}
+		if !strings.Contains(strings.ToLower(tracked.RiotID()), typed) {
+			continue
+		}
+		choices = append(choices, &discord.ApplicationCommandOptionChoice{
+			Name:  tracked.RiotID(),
+			Value: tracked.RiotID(),
+		})
+	}
+	if err := b.session.InteractionRespond(i.Interaction, &discord.InteractionResponse{
+		Type: discord.InteractionApplicationCommandAutocompleteResult,
+		Data: &discord.InteractionResponseData{
+			Choices: choices,
+		},
+	}); err != nil {
+		b.log.Printf("Error sending autocomplete choices: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package discord
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/thatliuser/simipangpang/pkg/riot/riottest"
+)
+
+func TestResolvePlayer(t *testing.T) {
+	srv := riottest.NewServer(sampleScenario())
+	defer srv.Close()
+	b, fake := newFakeDiscordBot(t, riottestClient(t, srv))
+	fake.addChannel("channel", "guild")
+	// Only Account-V1 should be needed to find out who someone is
+	srv.FailOn("/lol/", http.StatusInternalServerError)
+
+	server, err := b.ServerFor("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Link("linked-user", samplePUUID)
+
+	tests := []struct {
+		name   string
+		player string
+		// Empty if it should fail
+		want string
+	}{
+		{"riot id", "SimiPangPang#na1", samplePUUID},
+		{"linked mention", "<@linked-user>", samplePUUID},
+		{"nickname mention", "<@!linked-user>", samplePUUID},
+		{"unlinked mention", "<@someone-else>", ""},
+		{"unknown riot id", "nobody#NA1", ""},
+		{"untracked name", "simipangpang", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			puuid, err := b.resolvePlayer("guild", test.player)
+			if test.want == "" {
+				if err == nil {
+					t.Fatalf("got %v, want an error", puuid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if puuid != test.want {
+				t.Errorf("got %v, want %v", puuid, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Sends each interaction to the right handler. Commands and autocomplete go by command name,
+// components and modals go by the prefix of their custom ID. The rest of the custom ID is state,
+// so nothing has to be remembered between the message being sent and someone clicking on it.
+
+package discord
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	discord "github.com/bwmarrin/discordgo"
+)
+
+type handler func(*discord.InteractionCreate)
+
+// Discord rejects anything longer
+const maxCustomIDLength = 100
+
+const customIDSeparator = ":"
+
+// Fields can have the separator in them, so it (and the escape character) get escaped
+var customIDEscaper = strings.NewReplacer("%", "%25", customIDSeparator, "%3A")
+var customIDUnescaper = strings.NewReplacer("%3A", customIDSeparator, "%25", "%")
+
+// Packs the prefix and fields into a custom ID
+func encodeCustomID(prefix string, fields ...string) (string, error) {
+	parts := []string{prefix}
+	for _, field := range fields {
+		parts = append(parts, customIDEscaper.Replace(field))
+	}
+	customID := strings.Join(parts, customIDSeparator)
+	if len(customID) > maxCustomIDLength {
+		return "", fmt.Errorf("custom id %v is longer than %v characters", customID, maxCustomIDLength)
+	}
+	return customID, nil
+}
+
+// Unpacks what encodeCustomID packed
+func decodeCustomID(customID string) (string, []string) {
+	parts := strings.Split(customID, customIDSeparator)
+	fields := []string{}
+	for _, part := range parts[1:] {
+		fields = append(fields, customIDUnescaper.Replace(part))
+	}
+	return parts[0], fields
+}
+
+type router struct {
+	log          *log.Logger
+	commands     map[string]handler
+	autocomplete map[string]handler
+	components   map[string]handler
+	modals       map[string]handler
+}
+
+func newRouter(log *log.Logger) *router {
+	return &router{
+		log:          log,
+		commands:     make(map[string]handler),
+		autocomplete: make(map[string]handler),
+		components:   make(map[string]handler),
+		modals:       make(map[string]handler),
+	}
+}
+
+// The Data helpers on the interaction panic if they get the wrong type, so check the type first
+func (r *router) route(_ *discord.Session, i *discord.InteractionCreate) {
+	switch i.Type {
+	case discord.InteractionApplicationCommand:
+		r.dispatch(r.commands, i.ApplicationCommandData().Name, "command", i)
+	case discord.InteractionApplicationCommandAutocomplete:
+		r.dispatch(r.autocomplete, i.ApplicationCommandData().Name, "autocomplete", i)
+	case discord.InteractionMessageComponent:
+		prefix, _ := decodeCustomID(i.MessageComponentData().CustomID)
+		r.dispatch(r.components, prefix, "component", i)
+	case discord.InteractionModalSubmit:
+		prefix, _ := decodeCustomID(i.ModalSubmitData().CustomID)
+		r.dispatch(r.modals, prefix, "modal", i)
+	default:
+		r.log.Printf("Interaction type not recognized: %v", i.Type)
+	}
+}
+
+func (r *router) dispatch(handlers map[string]handler, key string, kind string, i *discord.InteractionCreate) {
+	if handler, ok := handlers[key]; ok {
+		handler(i)
+	} else {
+		r.log.Printf("Passed invalid %v name %v", kind, key)
+	}
+}
@@ -0,0 +1,231 @@
+// Update schedules. These are regular 5 field cron expressions (minute hour day month weekday),
+// or presets like "daily at 20:00" and "mondays at 09:00" for people that don't speak cron.
+
+package discord
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Set of allowed values for one cron field, one bit per value
+type cronField uint64
+
+func (f cronField) has(value int) bool {
+	return f&(1<<uint(value)) != 0
+}
+
+type cronBounds struct {
+	min, max int
+	// Lowercase names for values, indexed from min
+	names []string
+}
+
+var (
+	minuteBounds  = cronBounds{min: 0, max: 59}
+	hourBounds    = cronBounds{min: 0, max: 23}
+	dayBounds     = cronBounds{min: 1, max: 31}
+	monthBounds   = cronBounds{min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	weekdayBounds = cronBounds{min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat", "sun"}}
+)
+
+func (b cronBounds) value(value string) (int, error) {
+	for i, name := range b.names {
+		if strings.EqualFold(value, name) {
+			return b.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%v isn't a number", value)
+	}
+	if n < b.min || n > b.max {
+		return 0, fmt.Errorf("%v isn't between %v and %v", n, b.min, b.max)
+	}
+	return n, nil
+}
+
+// Takes stuff like *, 5, 1-5, */15 and 1,3,5
+func parseCronField(field string, bounds cronBounds) (cronField, error) {
+	parsed := cronField(0)
+	for _, item := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("step %v isn't a positive number", stepStr)
+			}
+			step = n
+		}
+
+		start, end := bounds.min, bounds.max
+		if rng != "*" {
+			lo, hi, isRange := strings.Cut(rng, "-")
+			n, err := bounds.value(lo)
+			if err != nil {
+				return 0, err
+			}
+			start, end = n, n
+			if isRange {
+				if end, err = bounds.value(hi); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// 5/15 means starting at 5
+				end = bounds.max
+			}
+			if end < start {
+				return 0, fmt.Errorf("range %v goes backwards", rng)
+			}
+		}
+		for n := start; n <= end; n += step {
+			parsed |= 1 << uint(n)
+		}
+	}
+	return parsed, nil
+}
+
+type schedule struct {
+	// What the user typed in, so it can be shown back to them and saved
+	spec    string
+	minutes cronField
+	hours   cronField
+	days    cronField
+	months  cronField
+	// 0 and 7 are both Sunday
+	weekdays cronField
+	// Cron matches either the day or the weekday if both are restricted, which needs to know which ones start with *
+	anyDay     bool
+	anyWeekday bool
+}
+
+var weekdayPresets = map[string]string{
+	"sunday":    "0",
+	"monday":    "1",
+	"tuesday":   "2",
+	"wednesday": "3",
+	"thursday":  "4",
+	"friday":    "5",
+	"saturday":  "6",
+	"weekday":   "1-5",
+	"weekend":   "0,6",
+}
+
+// Turns a preset into a cron expression, or returns it as is if it isn't one
+func expandPreset(spec string) (string, error) {
+	spec = strings.ToLower(strings.Join(strings.Fields(spec), " "))
+	switch strings.TrimPrefix(spec, "@") {
+	case "hourly":
+		return "0 * * * *", nil
+	case "daily":
+		return "0 0 * * *", nil
+	case "weekly":
+		return "0 0 * * 0", nil
+	case "monthly":
+		return "0 0 1 * *", nil
+	}
+
+	when, at, ok := strings.Cut(spec, " at ")
+	if !ok {
+		return spec, nil
+	}
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return "", fmt.Errorf("time %v isn't in the form HH:MM", at)
+	}
+	days := ""
+	when = strings.TrimPrefix(when, "every ")
+	if when == "day" || when == "daily" {
+		days = "*"
+	} else if preset, ok := weekdayPresets[strings.TrimSuffix(when, "s")]; ok {
+		days = preset
+	} else {
+		return "", fmt.Errorf("day %v not recognized (try daily, mondays, weekdays, etc.)", when)
+	}
+	return fmt.Sprintf("%v %v * * %v", clock.Minute(), clock.Hour(), days), nil
+}
+
+func parseSchedule(spec string) (*schedule, error) {
+	expanded, err := expandPreset(spec)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(expanded)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %v should have 5 fields (minute hour day month weekday) or be a preset like \"daily at 20:00\"", spec)
+	}
+
+	s := &schedule{
+		spec: strings.TrimSpace(spec),
+		// */2 and the like count too, like in Vixie cron
+		anyDay:     strings.HasPrefix(fields[2], "*"),
+		anyWeekday: strings.HasPrefix(fields[4], "*"),
+	}
+	for i, parse := range []struct {
+		field  *cronField
+		bounds cronBounds
+		name   string
+	}{
+		{&s.minutes, minuteBounds, "minute"},
+		{&s.hours, hourBounds, "hour"},
+		{&s.days, dayBounds, "day"},
+		{&s.months, monthBounds, "month"},
+		{&s.weekdays, weekdayBounds, "weekday"},
+	} {
+		field, err := parseCronField(fields[i], parse.bounds)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v field in schedule: %v", parse.name, err)
+		}
+		*parse.field = field
+	}
+	if s.weekdays.has(7) {
+		s.weekdays |= 1
+	}
+	return s, nil
+}
+
+func (s *schedule) dayMatches(t time.Time) bool {
+	day, weekday := s.days.has(t.Day()), s.weekdays.has(int(t.Weekday()))
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// Next time the schedule fires after the given time, in the given time zone.
+// Returns false if it never does (like on February 30th).
+func (s *schedule) next(after time.Time, loc *time.Location) (time.Time, bool) {
+	t := after.In(loc).Truncate(time.Minute).Add(time.Minute)
+	// Anything that can fire at all fires within a few years, leap days included
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, m, d := t.Date()
+		prev := t
+		switch {
+		case !s.months.has(int(m)):
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		case !s.hours.has(t.Hour()):
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, loc)
+		case !s.minutes.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+		if !t.After(prev) {
+			// Daylight savings can send time.Date backwards, so just push through it
+			t = prev.Add(time.Minute)
+		}
+	}
+	return time.Time{}, false
+}
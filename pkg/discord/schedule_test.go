@@ -0,0 +1,189 @@
+package discord
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	for _, test := range []struct {
+		field  string
+		bounds cronBounds
+		// Nil if it should fail
+		want []int
+	}{
+		{"*", hourBounds, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23}},
+		{"5", minuteBounds, []int{5}},
+		{"1-5", weekdayBounds, []int{1, 2, 3, 4, 5}},
+		{"mon-fri", weekdayBounds, []int{1, 2, 3, 4, 5}},
+		{"1,3,5", dayBounds, []int{1, 3, 5}},
+		{"*/15", minuteBounds, []int{0, 15, 30, 45}},
+		{"*/5", monthBounds, []int{1, 6, 11}},
+		{"5/20", minuteBounds, []int{5, 25, 45}},
+		{"9-17/4", hourBounds, []int{9, 13, 17}},
+		{"jan,JUN,dec", monthBounds, []int{1, 6, 12}},
+		{"1-3,20-22", dayBounds, []int{1, 2, 3, 20, 21, 22}},
+		{"60", minuteBounds, nil},
+		{"0", dayBounds, nil},
+		{"8", weekdayBounds, nil},
+		{"5-1", minuteBounds, nil},
+		{"*/0", minuteBounds, nil},
+		{"*/x", minuteBounds, nil},
+		{"noon", hourBounds, nil},
+		{"1-", hourBounds, nil},
+		{"", hourBounds, nil},
+	} {
+		t.Run(test.field, func(t *testing.T) {
+			field, err := parseCronField(test.field, test.bounds)
+			if test.want == nil {
+				if err == nil {
+					t.Fatalf("got %b, want an error", field)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []int{}
+			for n := test.bounds.min; n <= test.bounds.max; n++ {
+				if field.has(n) {
+					got = append(got, n)
+				}
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	for _, test := range []struct {
+		spec string
+		// Empty if it should fail
+		want string
+	}{
+		{"hourly", "0 * * * *"},
+		{"@daily", "0 0 * * *"},
+		{"Weekly", "0 0 * * 0"},
+		{"monthly", "0 0 1 * *"},
+		{"daily at 20:00", "0 20 * * *"},
+		{"every day at 07:30", "30 7 * * *"},
+		{"mondays at 09:00", "0 9 * * 1"},
+		{"  Fridays   at 18:15 ", "15 18 * * 5"},
+		{"weekdays at 08:00", "0 8 * * 1-5"},
+		{"weekends at 12:00", "0 12 * * 0,6"},
+		{"*/15 9-17 * * mon-fri", "*/15 9-17 * * mon-fri"},
+		{"daily at 25:00", ""},
+		{"daily at noon", ""},
+		{"fortnightly at 10:00", ""},
+		{"* * * *", ""},
+		{"* * * * * *", ""},
+		{"60 * * * *", ""},
+		{"* 24 * * *", ""},
+		{"* * 32 * *", ""},
+		{"* * * 13 *", ""},
+		{"* * * * 8", ""},
+		{"", ""},
+	} {
+		t.Run(test.spec, func(t *testing.T) {
+			s, err := parseSchedule(test.spec)
+			if test.want == "" {
+				if err == nil {
+					t.Fatal("got a schedule, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Shown back to the user the way they typed it
+			if s.spec != strings.TrimSpace(test.spec) {
+				t.Errorf("got spec %q, want %q", s.spec, strings.TrimSpace(test.spec))
+			}
+			want, err := parseSchedule(test.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want.spec = s.spec
+			if *s != *want {
+				t.Errorf("got %+v, want the same as %v", s, test.want)
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A Sunday
+	sunday := time.Date(2024, 3, 10, 20, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		name  string
+		spec  string
+		after time.Time
+		loc   *time.Location
+		// Zero if it should never fire
+		want time.Time
+	}{
+		{"hourly", "hourly", sunday, time.UTC, time.Date(2024, 3, 10, 21, 0, 0, 0, time.UTC)},
+		{"daily later today", "daily at 21:30", sunday, time.UTC, time.Date(2024, 3, 10, 21, 30, 0, 0, time.UTC)},
+		// Firing right now doesn't count, it already did
+		{"daily right now", "daily at 20:00", sunday, time.UTC, time.Date(2024, 3, 11, 20, 0, 0, 0, time.UTC)},
+		{"weekly", "weekly", sunday, time.UTC, time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"monthly", "monthly", sunday, time.UTC, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"mondays", "mondays at 09:00", sunday, time.UTC, time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)},
+		{"weekends", "weekends at 12:00", sunday, time.UTC, time.Date(2024, 3, 16, 12, 0, 0, 0, time.UTC)},
+		{"sunday as 7", "0 0 * * 7", sunday, time.UTC, time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"seconds are dropped", "*/15 * * * *", sunday.Add(14*time.Minute + 59*time.Second), time.UTC, time.Date(2024, 3, 10, 20, 15, 0, 0, time.UTC)},
+		{"step from an offset", "5/20 * * * *", sunday.Add(30 * time.Minute), time.UTC, time.Date(2024, 3, 10, 20, 45, 0, 0, time.UTC)},
+		{"hour range with a step", "0 9-17/4 * * *", sunday, time.UTC, time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)},
+		{"month range", "0 12 1 feb-apr *", sunday, time.UTC, time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)},
+		{"next year", "0 0 1 jan *", sunday, time.UTC, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"in the time zone", "daily at 09:00", sunday, la, time.Date(2024, 3, 11, 9, 0, 0, 0, la)},
+		// The 13th is a Wednesday, and either one is enough when both are restricted
+		{"day or weekday", "0 0 13 * fri", sunday, time.UTC, time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC)},
+		{"weekday or day", "0 0 22 * fri", sunday, time.UTC, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		// Starting with * means it doesn't restrict anything, even with a step
+		{"stepped weekday", "0 0 20 * */1", sunday, time.UTC, time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)},
+		{"stepped day", "0 0 */1 * fri", sunday, time.UTC, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", sunday, time.UTC, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Clocks jump from 2:00 to 3:00 in LA that day, so 2:30 just doesn't happen
+		{"skipped by daylight savings", "30 2 * * *", time.Date(2024, 3, 10, 0, 0, 0, 0, la), la, time.Date(2024, 3, 11, 2, 30, 0, 0, la)},
+		{"right after the jump", "0 3 * * *", time.Date(2024, 3, 10, 0, 0, 0, 0, la), la, time.Date(2024, 3, 10, 3, 0, 0, 0, la)},
+		// 1:30 happens twice when clocks go back, and the first one is the one that counts
+		{"repeated by daylight savings", "30 1 * * *", time.Date(2024, 11, 3, 0, 0, 0, 0, la), la, time.Date(2024, 11, 3, 8, 30, 0, 0, time.UTC)},
+		{"february 30th", "0 0 30 2 *", sunday, time.UTC, time.Time{}},
+		{"april 31st", "0 0 31 apr *", sunday, time.UTC, time.Time{}},
+		// Still fires on the weekday
+		{"april 31st or mondays", "0 0 31 apr mon", sunday, time.UTC, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := parseSchedule(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := s.next(test.after, test.loc)
+			if test.want.IsZero() {
+				if ok {
+					t.Fatalf("got %v, want it to never fire", got)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("never fires, want %v", test.want)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			if got.Location() != test.loc {
+				t.Errorf("got %v in %v, want it in %v", got, got.Location(), test.loc)
+			}
+		})
+	}
+}
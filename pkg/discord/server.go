@@ -10,10 +10,14 @@ import (
 	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Kyagara/equinox/clients/ddragon"
 	discord "github.com/bwmarrin/discordgo"
+	"github.com/thatliuser/simipangpang/pkg/riot"
 )
 
 // Stuff that gets JSON'ed
@@ -21,18 +25,60 @@ type serverState struct {
 	GuildID       string `json:"guild_id"`
 	ChannelID     string `json:"channel_id"`
 	PeriodMinutes int64  `json:"period_minutes"`
+	Language      string `json:"language"`
+	// Discord user ID to PUUID
+	Links             map[string]string `json:"links"`
+	WeeklyLeaderboard bool              `json:"weekly_leaderboard"`
+	LeaderboardPosted time.Time         `json:"leaderboard_posted"`
+	// Takes over from the period if it's set
+	Schedule string `json:"schedule"`
+	Timezone string `json:"timezone"`
+	// When the last update went out, so restarts don't lose track of the schedule
+	LastUpdate time.Time `json:"last_update"`
+	CatchUp    string    `json:"catch_up"`
 }
 
 type Server struct {
-	log     *log.Logger
-	bot     *Bot
-	guild   *discord.Guild
+	log   *log.Logger
+	bot   *Bot
+	guild *discord.Guild
+	// Guards everything below, since commands and updates come in on different goroutines
+	mu      sync.Mutex
 	channel *discord.Channel
 	period  time.Duration // Should be in minutes
-	ticker  *time.Ticker
-	done    chan struct{}
+	// Empty means use the guild's locale
+	lang ddragon.Language
+	// Discord user ID to PUUID
+	links map[string]string
+	// Links that haven't been verified yet, also by Discord user ID
+	pending           map[string]pendingLink
+	weeklyLeaderboard bool
+	leaderboardPosted time.Time
+	// Cron schedule for updates, used instead of the period if it's set
+	schedule *schedule
+	// Nil means UTC
+	loc        *time.Location
+	lastUpdate time.Time
+	// What to do about updates that were missed while the bot was down. Empty means catchUpRun.
+	catchUp string
+	// Update channel that was gone when the server got loaded, so admins can be told once the bot connects
+	missingChannel string
+	// Whether the missing channel is still there and the bot just can't see it
+	hiddenChannel bool
+	// Set by Stop. Nothing gets scheduled after this, even by an update that was already going.
+	stopped bool
 }
 
+const (
+	// Send one update for everything that got missed
+	catchUpRun = "run"
+	// Pretend nothing got missed and wait for the next one
+	catchUpSkip = "skip"
+)
+
+// Catch up updates wait a bit so the bot can finish starting up first
+const catchUpDelay = time.Minute
+
 const (
 	stateDir = "state"
 	saveExt  = ".json"
@@ -49,7 +95,7 @@ func (s *Server) BackupFileName() string {
 	return fmt.Sprintf("%v/%v-backup%v", stateDir, s.guild.ID, saveExt)
 }
 
-func (s *Server) readFile(name string) ([]byte, error) {
+func readFile(name string) ([]byte, error) {
 	contents, err := os.ReadFile(name)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
@@ -62,8 +108,8 @@ func (s *Server) readFile(name string) ([]byte, error) {
 	return contents, nil
 }
 
-func (s *Server) writeFile(name string, data []byte) error {
-	if err := os.MkdirAll(stateDir, dirMode); err != nil {
+func writeFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), dirMode); err != nil {
 		return fmt.Errorf("couldn't create state directory: %v", err)
 	}
 
@@ -79,31 +125,92 @@ func (s *Server) Load(state serverState) error {
 	if err != nil {
 		return fmt.Errorf("couldn't lookup guild %v by id: %v", state.GuildID, err)
 	}
+	return s.loadGuild(guild, state)
+}
+
+// Same as Load, for when the guild was already looked up
+func (s *Server) loadGuild(guild *discord.Guild, state serverState) error {
 	s.guild = guild
 
+	channel := (*discord.Channel)(nil)
+	hidden := false
 	if state.ChannelID != "" {
 		// Validate channel ID since it's set
-		channel, err := s.bot.ChannelByID(state.ChannelID)
-		if err != nil {
+		var err error
+		channel, err = s.bot.ChannelByID(state.ChannelID)
+		if restErrorIs(err, discord.ErrCodeUnknownChannel) {
+			// Deleted while the bot was down, which shouldn't throw out the rest of the settings
+			s.log.Printf("Update channel %v for server %v is gone, resetting it", state.ChannelID, state.GuildID)
+			channel = nil
+		} else if restErrorIs(err, discord.ErrCodeMissingAccess) {
+			// Probably just permissions being shuffled around, so hang on to it until they're fixed
+			s.log.Printf("Can't see update channel %v for server %v, keeping it anyways", state.ChannelID, state.GuildID)
+			channel = &discord.Channel{ID: state.ChannelID, GuildID: state.GuildID}
+			hidden = true
+		} else if err != nil {
 			return fmt.Errorf("couldn't lookup channel %v by id: %v", state.ChannelID, err)
 		}
-		s.channel = channel
-	} else {
-		s.channel = nil
 	}
 
-	if state.PeriodMinutes != 0 {
+	s.mu.Lock()
+	s.channel = channel
+	s.missingChannel = ""
+	s.hiddenChannel = hidden
+	if state.ChannelID != "" && (channel == nil || hidden) {
+		s.missingChannel = state.ChannelID
+	}
+	// These need to be set before the timer is, since it goes off of them
+	s.lastUpdate = state.LastUpdate
+	s.catchUp = ""
+	s.loc = nil
+	s.lang = ""
+	s.mu.Unlock()
+
+	if state.CatchUp != "" {
+		if err := s.SetCatchUp(state.CatchUp); err != nil {
+			return fmt.Errorf("invalid catch up policy: %v", err)
+		}
+	}
+	if state.Timezone != "" {
+		if err := s.SetTimezone(state.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %v", err)
+		}
+	}
+
+	if state.Schedule != "" {
+		if err := s.SetSchedule(state.Schedule); err != nil {
+			return fmt.Errorf("invalid schedule: %v", err)
+		}
+	} else if state.PeriodMinutes != 0 {
 		// Validate period since it's set
 		if err := s.SetPeriod(state.PeriodMinutes); err != nil {
 			return fmt.Errorf("invalid period: %v", err)
 		}
 	}
 
+	if state.Language != "" {
+		if err := s.SetLanguage(state.Language); err != nil {
+			return fmt.Errorf("invalid language: %v", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links = make(map[string]string)
+	for user, puuid := range state.Links {
+		s.links[user] = puuid
+	}
+	s.pending = make(map[string]pendingLink)
+	s.weeklyLeaderboard = state.WeeklyLeaderboard
+	s.leaderboardPosted = state.LeaderboardPosted
+
+	s.catchUpMissed(time.Now())
+	s.armLeaderboard(time.Now())
 	return nil
 }
 
 func (s *Server) LoadFile() error {
-	contents, err := s.readFile(s.SaveFileName())
+	contents, err := readFile(s.SaveFileName())
 	if err != nil {
 		return fmt.Errorf("couldn't open server save: %v", err)
 	} else if contents == nil {
@@ -119,14 +226,14 @@ func (s *Server) LoadFile() error {
 }
 
 func (s *Server) Backup() error {
-	contents, err := s.readFile(s.SaveFileName())
+	contents, err := readFile(s.SaveFileName())
 	if err != nil {
 		return fmt.Errorf("couldn't open server save: %v", err)
 	} else if contents == nil {
 		return nil
 	}
 
-	if err := s.writeFile(s.BackupFileName(), contents); err != nil {
+	if err := writeFile(s.BackupFileName(), contents); err != nil {
 		return fmt.Errorf("couldn't write to backup: %v", err)
 	}
 
@@ -134,6 +241,18 @@ func (s *Server) Backup() error {
 }
 
 func (s *Server) Save() error {
+	// Held the whole time so two saves don't write over each other
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		// Stop already saved everything, and the save might've been archived since
+		return nil
+	}
+	return s.save()
+}
+
+// Has to be called with the lock held
+func (s *Server) save() error {
 	// Backup the existing file if it exists
 	if err := s.Backup(); err != nil {
 		return fmt.Errorf("couldn't copy contents to backup: %v", err)
@@ -143,6 +262,13 @@ func (s *Server) Save() error {
 		GuildID:       s.guild.ID,
 		ChannelID:     "",
 		PeriodMinutes: 0,
+		Language:      string(s.lang),
+		Links:         s.links,
+		// Always set so turning it off sticks
+		WeeklyLeaderboard: s.weeklyLeaderboard,
+		LeaderboardPosted: s.leaderboardPosted,
+		LastUpdate:        s.lastUpdate,
+		CatchUp:           s.catchUp,
 	}
 	// Conditionally set these values
 	if s.channel != nil {
@@ -152,12 +278,18 @@ func (s *Server) Save() error {
 	if period != 0 {
 		state.PeriodMinutes = period
 	}
+	if s.schedule != nil {
+		state.Schedule = s.schedule.spec
+	}
+	if s.loc != nil {
+		state.Timezone = s.loc.String()
+	}
 
 	data, err := json.MarshalIndent(&state, "", "\t")
 	if err != nil {
 		return fmt.Errorf("couldn't marshal server data: %v", err)
 	}
-	if err := s.writeFile(s.SaveFileName(), data); err != nil {
+	if err := writeFile(s.SaveFileName(), data); err != nil {
 		return fmt.Errorf("couldn't save server: %v", err)
 	}
 
@@ -180,12 +312,23 @@ func (s *Server) SetChannel(channelID string) error {
 		return fmt.Errorf("bot has no perms to send messages in channel %v", channel.Mention())
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.channel = channel
 	s.log.Printf("Setting update channel for server %v to %v", s.guild.ID, s.channel.Mention())
 	return nil
 }
 
+// Nil if there isn't one
+func (s *Server) Channel() *discord.Channel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.channel
+}
+
 func (s *Server) GetChannel() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.channel == nil {
 		return "<unset>"
 	} else {
@@ -193,34 +336,217 @@ func (s *Server) GetChannel() string {
 	}
 }
 
+// Returns the update channel that went missing during loading, if there was one, and forgets about it.
+// Hidden means it's still set, the bot just doesn't have access to it.
+func (s *Server) takeMissingChannel() (id string, hidden bool, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, hidden = s.missingChannel, s.hiddenChannel
+	s.missingChannel, s.hiddenChannel = "", false
+	return id, hidden, id != ""
+}
+
 func (s *Server) ResetChannel() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.log.Printf("Resetting update channel for server %v", s.guild.ID)
 	s.channel = nil
 }
 
-// This should be spawned in a Goroutine to listen to ticks
+func (s *Server) SetLanguage(lang string) error {
+	language, err := riot.ParseLanguage(lang)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lang = language
+	s.log.Printf("Set language for server %v to %v", s.guild.ID, s.lang)
+	return nil
+}
+
+// Falls back to the guild's locale if there's no language set, and then English
+func (s *Server) Language() ddragon.Language {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.language()
+}
+
+// Has to be called with the lock held
+func (s *Server) language() ddragon.Language {
+	if s.lang != "" {
+		return s.lang
+	}
+	if lang, err := riot.ParseLanguage(s.guild.PreferredLocale); err == nil {
+		return lang
+	}
+	return riot.DefaultLanguage
+}
+
+func (s *Server) GetLanguage() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lang == "" {
+		return fmt.Sprintf("<unset> (using %v)", s.language())
+	} else {
+		return string(s.lang)
+	}
+}
+
+func (s *Server) SetWeeklyLeaderboard(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.weeklyLeaderboard = enabled
+	s.log.Printf("Set weekly leaderboard for server %v to %v", s.guild.ID, enabled)
+	s.armLeaderboard(time.Now())
+}
+
+func (s *Server) GetWeeklyLeaderboard() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.weeklyLeaderboard {
+		return "on"
+	} else {
+		return "off"
+	}
+}
+
+// The channel to post the weekly leaderboard in, if it's turned on and hasn't gone out this week
+func (s *Server) leaderboardDue(now time.Time) (*discord.Channel, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.weeklyLeaderboard || s.channel == nil || !s.leaderboardPosted.Before(weekStart(now)) {
+		return nil, false
+	}
+	return s.channel, true
+}
+
+func (s *Server) leaderboardJobKey() string {
+	return "leaderboard:" + s.guild.ID
+}
+
+// Schedules the weekly leaderboard on its own, so it goes out even if updates are off.
+// Has to be called with the lock held.
+func (s *Server) armLeaderboard(now time.Time) {
+	if s.stopped {
+		return
+	}
+	if !s.weeklyLeaderboard {
+		s.bot.jobs.Cancel(s.leaderboardJobKey())
+		return
+	}
+	at := leaderboardPostTime(now, s.location())
+	if !at.After(now) && !s.leaderboardPosted.Before(at) {
+		// Already went out this week
+		at = leaderboardPostTime(at.AddDate(0, 0, 7), s.location())
+	} else if !at.After(now) {
+		// Missed it, probably because the bot was down
+		at = now.Add(catchUpDelay)
+	}
+	s.bot.jobs.Schedule(s.leaderboardJobKey(), s.guild.ID, at, s.leaderboardTick)
+}
+
+func (s *Server) setLeaderboardPosted(at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leaderboardPosted = at
+}
+
+func (s *Server) ResetLanguage() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log.Printf("Resetting language for server %v", s.guild.ID)
+	s.lang = ""
+}
+
+func (s *Server) jobKey() string {
+	return "update:" + s.guild.ID
+}
+
+// Runs whenever the update job goes off. The lock isn't held while the update goes out, since that takes a while.
 func (s *Server) tick() {
-	for {
-		select {
-		case <-s.ticker.C:
-			if s.channel != nil {
-				s.bot.UpdateTick(s.channel)
-			}
-		case <-s.done:
-			return
-		}
+	s.mu.Lock()
+	channel, lang, stopped := s.channel, s.language(), s.stopped
+	s.mu.Unlock()
+	if stopped {
+		return
+	}
+	if channel != nil {
+		s.bot.UpdateTick(channel, lang)
+	}
+
+	s.mu.Lock()
+	if s.stopped {
+		// Stopped while the update was going out, so there's no next one
+		s.mu.Unlock()
+		return
 	}
+	s.lastUpdate = time.Now()
+	s.refreshTimer()
+	s.mu.Unlock()
+	if err := s.Save(); err != nil {
+		s.log.Printf("Couldn't save server %v after update: %v", s.guild.ID, err)
+	}
+}
+
+// When the next update should go out, if there's one scheduled at all.
+// This and everything else to do with the timer has to be called with the lock held.
+func (s *Server) nextTick(now time.Time) (time.Time, bool) {
+	if s.schedule != nil {
+		return s.schedule.next(now, s.location())
+	}
+	if s.period == 0 {
+		return time.Time{}, false
+	}
+	if s.lastUpdate.IsZero() {
+		return now.Add(s.period), true
+	}
+	// Keep counting from the last update, so restarts don't reset the countdown
+	next := s.lastUpdate.Add(s.period)
+	if next.Before(now) {
+		next = next.Add((now.Sub(next)/s.period + 1) * s.period)
+	}
+	return next, true
+}
+
+// Whether an update should've gone out between the last one and now
+func (s *Server) missedTick(now time.Time) bool {
+	if s.lastUpdate.IsZero() {
+		return false
+	}
+	if s.schedule != nil {
+		next, ok := s.schedule.next(s.lastUpdate, s.location())
+		return ok && next.Before(now)
+	}
+	return s.period != 0 && s.lastUpdate.Add(s.period).Before(now)
 }
 
-func (s *Server) refreshTicker() {
-	if s.ticker == nil {
-		s.log.Printf("Detected nil ticker, creating new ticker for server %v", s.guild.ID)
-		// Setup ticker logic if not initialized
-		s.ticker = time.NewTicker(s.period)
-		s.done = make(chan struct{})
-		go s.tick()
+// Meant to be called once the server is loaded
+func (s *Server) catchUpMissed(now time.Time) {
+	if !s.missedTick(now) {
+		return
+	}
+	if s.catchUp == catchUpSkip {
+		s.log.Printf("Skipping updates missed since %v for server %v", s.lastUpdate, s.guild.ID)
+		return
+	}
+	s.log.Printf("Catching up on updates missed since %v for server %v", s.lastUpdate, s.guild.ID)
+	s.armTimer(now.Add(catchUpDelay), true)
+}
+
+func (s *Server) refreshTimer() {
+	s.armTimer(s.nextTick(time.Now()))
+}
+
+func (s *Server) armTimer(next time.Time, ok bool) {
+	if s.stopped {
+		return
+	}
+	if ok {
+		s.bot.jobs.Schedule(s.jobKey(), s.guild.ID, next, s.tick)
+	} else {
+		s.bot.jobs.Cancel(s.jobKey())
 	}
-	s.ticker.Reset(s.period)
 }
 
 func (s *Server) SetPeriod(minutes int64) error {
@@ -228,31 +554,163 @@ func (s *Server) SetPeriod(minutes int64) error {
 		return fmt.Errorf("negative or zero period not allowed")
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	period := time.Duration(minutes) * time.Minute
 	s.period = period
+	// Only one of these can be in charge
+	s.schedule = nil
 	s.log.Printf("Set period for server %v to %v", s.guild.ID, s.period)
 
-	s.refreshTicker()
+	s.refreshTimer()
 	return nil
 }
 
 func (s *Server) GetPeriod() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return int64(s.period.Minutes())
 }
 
 func (s *Server) ResetPeriod() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.period = 0
-	s.log.Printf("Resetting period for server %v, freeing timer", s.guild.ID)
-	s.ticker.Stop()
-	s.ticker = nil
+	s.log.Printf("Resetting period for server %v", s.guild.ID)
+	s.refreshTimer()
+}
+
+func (s *Server) SetSchedule(spec string) error {
+	sched, err := parseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := sched.next(time.Now(), s.location()); !ok {
+		return fmt.Errorf("schedule %v never runs", spec)
+	}
+	s.schedule = sched
+	s.period = 0
+	s.log.Printf("Set schedule for server %v to %v", s.guild.ID, sched.spec)
+
+	s.refreshTimer()
+	return nil
+}
+
+func (s *Server) GetSchedule() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.schedule == nil {
+		return "<unset>"
+	}
+	if next, ok := s.nextTick(time.Now()); ok {
+		return fmt.Sprintf("`%v` (next update <t:%v:R>)", s.schedule.spec, next.Unix())
+	}
+	return fmt.Sprintf("`%v`", s.schedule.spec)
+}
+
+func (s *Server) ResetSchedule() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedule = nil
+	s.log.Printf("Resetting schedule for server %v", s.guild.ID)
+	s.refreshTimer()
+}
+
+// Takes IANA names like America/Los_Angeles
+func (s *Server) SetTimezone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("time zone not recognized: %v", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loc = loc
+	s.log.Printf("Set timezone for server %v to %v", s.guild.ID, loc)
+
+	// The next update might be at a different time now, and so might the leaderboard
+	s.refreshTimer()
+	s.armLeaderboard(time.Now())
+	return nil
+}
+
+func (s *Server) Location() *time.Location {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.location()
+}
+
+// Has to be called with the lock held
+func (s *Server) location() *time.Location {
+	if s.loc == nil {
+		return time.UTC
+	}
+	return s.loc
+}
+
+func (s *Server) GetTimezone() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loc == nil {
+		return "<unset> (using UTC)"
+	} else {
+		return s.loc.String()
+	}
+}
+
+func (s *Server) SetCatchUp(policy string) error {
+	switch policy {
+	case catchUpRun, catchUpSkip:
+	default:
+		return fmt.Errorf("catch up policy not recognized: %v (should be %v or %v)", policy, catchUpRun, catchUpSkip)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.catchUp = policy
+	s.log.Printf("Set catch up policy for server %v to %v", s.guild.ID, s.catchUp)
+	return nil
+}
+
+func (s *Server) GetCatchUp() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.catchUp == "" {
+		return fmt.Sprintf("<unset> (using %v)", catchUpRun)
+	} else {
+		return s.catchUp
+	}
 }
 
+func (s *Server) ResetCatchUp() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.catchUp = ""
+	s.log.Printf("Resetting catch up policy for server %v", s.guild.ID)
+}
+
+func (s *Server) ResetTimezone() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loc = nil
+	s.log.Printf("Resetting timezone for server %v", s.guild.ID)
+	s.refreshTimer()
+	s.armLeaderboard(time.Now())
+}
+
+// Saves the server one last time and stops its updates. Nothing gets written after this,
+// so the save can be moved somewhere else once it returns. A new server has to be made to start it again.
 func (s *Server) Stop() {
-	if s.ticker != nil {
-		s.ticker.Stop()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
 	}
-	if s.done != nil {
-		s.done <- struct{}{}
+	s.stopped = true
+	s.bot.jobs.Cancel(s.jobKey())
+	s.bot.jobs.Cancel(s.leaderboardJobKey())
+	if err := s.save(); err != nil {
+		s.log.Printf("Couldn't save server %v while stopping: %v", s.guild.ID, err)
 	}
 }
 
@@ -271,6 +729,19 @@ func NewServer(bot *Bot, output io.Writer, guildID string) (*Server, error) {
 	return s, nil
 }
 
+// Doesn't look the guild up, so it works without Discord as long as the state has no channel
+// (or the channel is already in the session's cache)
+func newServerFromState(bot *Bot, output io.Writer, guild *discord.Guild, state serverState) (*Server, error) {
+	s := &Server{
+		bot: bot,
+		log: log.New(output, "discord.Server: ", log.Ldate|log.Ltime),
+	}
+	if err := s.loadGuild(guild, state); err != nil {
+		return nil, fmt.Errorf("couldn't create server: %v", err)
+	}
+	return s, nil
+}
+
 func ServerFromFile(bot *Bot, output io.Writer, guildID string) (*Server, error) {
 	// Preliminary load so SaveFileName() doesn't deref a nil pointer
 	s, err := NewServer(bot, output, guildID)
@@ -297,7 +768,14 @@ func AllServerIDs() ([]string, error) {
 			return err
 		}
 
-		if d.IsDir() || strings.Contains(path, "backup") {
+		if d.IsDir() {
+			if path != "." {
+				// Only servers live at the top level
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if strings.Contains(path, "backup") {
 			return nil
 		}
 
@@ -0,0 +1,258 @@
+package discord
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	discord "github.com/bwmarrin/discordgo"
+	"github.com/thatliuser/simipangpang/pkg/riot"
+)
+
+func TestNewServerFromState(t *testing.T) {
+	b := newTestBot(t, sampleClient())
+	guild := &discord.Guild{ID: "guild", Name: "Test guild"}
+	server, err := newServerFromState(b, io.Discard, guild, serverState{
+		GuildID:       guild.ID,
+		PeriodMinutes: 60,
+		Language:      "ko_KR",
+		Links:         map[string]string{"user": samplePUUID},
+		Timezone:      "America/Los_Angeles",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if period := server.GetPeriod(); period != 60 {
+		t.Errorf("got period %v, want 60", period)
+	}
+	if lang := server.Language(); lang != "ko_KR" {
+		t.Errorf("got language %v, want ko_KR", lang)
+	}
+	if puuid, ok := server.LinkFor("user"); !ok || puuid != samplePUUID {
+		t.Errorf("got link %v, %v, want %v", puuid, ok, samplePUUID)
+	}
+	if loc := server.Location(); loc.String() != "America/Los_Angeles" {
+		t.Errorf("got time zone %v, want America/Los_Angeles", loc)
+	}
+}
+
+// Run with -race. Config commands, update ticks, saves and recaps all come in on their own goroutines.
+func TestServerConcurrentConfigAndTicks(t *testing.T) {
+	b, fake := newFakeDiscordBot(t, sampleClient())
+	guilds := []string{"guild-1", "guild-2", "guild-3"}
+	for _, guild := range guilds {
+		fake.addChannel("channel-"+guild, guild)
+	}
+
+	// Each of these runs against every guild from a bunch of goroutines at once
+	changes := []func(s *Server, guild string) error{
+		func(s *Server, guild string) error { return s.SetChannel("channel-" + guild) },
+		func(s *Server, guild string) error { s.ResetChannel(); return nil },
+		func(s *Server, guild string) error { return s.SetPeriod(30) },
+		func(s *Server, guild string) error { s.ResetPeriod(); return nil },
+		func(s *Server, guild string) error { return s.SetSchedule("daily at 20:00") },
+		func(s *Server, guild string) error { s.ResetSchedule(); return nil },
+		func(s *Server, guild string) error { return s.SetTimezone("America/New_York") },
+		func(s *Server, guild string) error { s.ResetTimezone(); return nil },
+		func(s *Server, guild string) error { return s.SetLanguage("ko_KR") },
+		func(s *Server, guild string) error { s.ResetLanguage(); return nil },
+		func(s *Server, guild string) error { return s.SetCatchUp(catchUpSkip) },
+		func(s *Server, guild string) error { s.ResetCatchUp(); return nil },
+		func(s *Server, guild string) error { s.SetWeeklyLeaderboard(true); return nil },
+		func(s *Server, guild string) error { s.SetWeeklyLeaderboard(false); return nil },
+		func(s *Server, guild string) error { s.Link("user", samplePUUID); return nil },
+		func(s *Server, guild string) error { s.Unlink("user"); return nil },
+		func(s *Server, guild string) error {
+			// Everything that reads, like /update get does
+			s.GetChannel()
+			s.GetPeriod()
+			s.GetSchedule()
+			s.GetTimezone()
+			s.GetLanguage()
+			s.GetCatchUp()
+			s.GetWeeklyLeaderboard()
+			s.Links()
+			return nil
+		},
+	}
+
+	servers := sync.Map{}
+	wg := sync.WaitGroup{}
+	for round := 0; round < 4; round++ {
+		for i, change := range changes {
+			for _, guild := range guilds {
+				wg.Add(1)
+				go func(i int, change func(*Server, string) error, guild string) {
+					defer wg.Done()
+					server, err := b.ServerFor(guild)
+					if err != nil {
+						t.Errorf("couldn't get server for %v: %v", guild, err)
+						return
+					}
+					if first, loaded := servers.LoadOrStore(guild, server); loaded && first != server {
+						t.Errorf("got two different servers for %v", guild)
+					}
+					if err := change(server, guild); err != nil {
+						t.Errorf("change %v failed for %v: %v", i, guild, err)
+					}
+					if i%3 == 0 {
+						server.tick()
+					}
+					if err := server.Save(); err != nil {
+						t.Errorf("couldn't save %v: %v", guild, err)
+					}
+				}(i, change, guild)
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.SplitRecap(&riot.Split{Name: "Test split", Start: sampleNow.AddDate(0, -3, 0), End: sampleNow})
+		}()
+	}
+	wg.Wait()
+
+	for _, guild := range guilds {
+		if _, ok := b.servers.get(guild); !ok {
+			t.Errorf("server for %v isn't in the registry", guild)
+		}
+	}
+}
+
+// Adding and removing servers while everything else is going on
+func TestServerRegistryConcurrent(t *testing.T) {
+	b, _ := newFakeDiscordBot(t, sampleClient())
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		guild := fmt.Sprintf("guild-%v", i%5)
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if _, err := b.ServerFor(guild); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if server, ok := b.servers.remove(guild); ok {
+				server.Stop()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			b.Save()
+			for _, server := range b.servers.all() {
+				server.Channel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Stopped servers shouldn't have anything left in the queue
+	time.Sleep(10 * time.Millisecond)
+	for _, job := range b.jobs.Upcoming() {
+		if _, ok := b.servers.get(job.guild); !ok {
+			t.Errorf("job %v is still scheduled for a server that was removed", job.key)
+		}
+	}
+}
+
+// The bot getting kicked while an update is going out shouldn't schedule another one, or bring the save back
+func TestStopMidUpdate(t *testing.T) {
+	b, fake := newFakeDiscordBot(t, sampleClient())
+	fake.addChannel("channel", "guild")
+	server, err := b.ServerFor("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetChannel("channel"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetPeriod(30); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.sending = make(chan string)
+	fake.release = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		server.tick()
+		close(done)
+	}()
+	// The update is on its way out now
+	<-fake.sending
+	b.onGuildDelete(nil, &discord.GuildDelete{Guild: &discord.Guild{ID: "guild"}})
+	close(fake.release)
+	<-done
+
+	if n := fake.sentTo("channel"); n != 1 {
+		t.Errorf("sent %v updates, want 1", n)
+	}
+	for _, job := range b.jobs.Upcoming() {
+		if job.guild == "guild" {
+			t.Errorf("job %v was scheduled after the server stopped", job.key)
+		}
+	}
+	if _, err := os.Stat(server.SaveFileName()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("save was written after the server was archived (stat says %v)", err)
+	}
+	if _, err := os.Stat(archiveFileName("guild")); err != nil {
+		t.Errorf("server wasn't archived: %v", err)
+	}
+}
+
+// Updates that should've gone out while the bot was down
+func TestCatchUpMissed(t *testing.T) {
+	b := newTestBot(t, sampleClient())
+	now := time.Now()
+	hourly, err := parseSchedule("hourly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextHour, _ := hourly.next(now, time.UTC)
+
+	tests := []struct {
+		name  string
+		state serverState
+		// When the next update should be
+		want time.Time
+	}{
+		{"missed", serverState{PeriodMinutes: 60, LastUpdate: now.Add(-3 * time.Hour)}, now.Add(catchUpDelay)},
+		{"missed and set to run", serverState{PeriodMinutes: 60, LastUpdate: now.Add(-3 * time.Hour), CatchUp: catchUpRun}, now.Add(catchUpDelay)},
+		// Goes back to counting from the last update like nothing happened
+		{"missed and set to skip", serverState{PeriodMinutes: 60, LastUpdate: now.Add(-3 * time.Hour), CatchUp: catchUpSkip}, now.Add(time.Hour)},
+		{"missed on a schedule", serverState{Schedule: "hourly", LastUpdate: now.Add(-3 * time.Hour)}, now.Add(catchUpDelay)},
+		{"missed on a schedule and set to skip", serverState{Schedule: "hourly", LastUpdate: now.Add(-3 * time.Hour), CatchUp: catchUpSkip}, nextHour},
+		{"nothing missed", serverState{PeriodMinutes: 60, LastUpdate: now.Add(-10 * time.Minute)}, now.Add(50 * time.Minute)},
+		{"never updated", serverState{PeriodMinutes: 60}, now.Add(time.Hour)},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			guild := &discord.Guild{ID: fmt.Sprintf("guild-%v", i)}
+			test.state.GuildID = guild.ID
+			server, err := newServerFromState(b, io.Discard, guild, test.state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer server.Stop()
+
+			for _, job := range b.jobs.Upcoming() {
+				if job.key != server.jobKey() {
+					continue
+				}
+				if diff := job.at.Sub(test.want); diff < -5*time.Second || diff > 5*time.Second {
+					t.Errorf("next update is at %v, want %v", job.at, test.want)
+				}
+				return
+			}
+			t.Error("no update scheduled")
+		})
+	}
+}
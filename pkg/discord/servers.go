@@ -4,29 +4,105 @@ package discord
 
 import (
 	"fmt"
+	"sync"
 
+	"github.com/Kyagara/equinox/clients/ddragon"
 	discord "github.com/bwmarrin/discordgo"
+	"github.com/thatliuser/simipangpang/pkg/riot"
 )
 
+// Every server the bot knows about, by guild ID. Handlers for different interactions run at the same time,
+// so this can't be a plain map.
+type serverRegistry struct {
+	mu      sync.RWMutex
+	servers map[string]*Server
+}
+
+func newServerRegistry() *serverRegistry {
+	return &serverRegistry{servers: make(map[string]*Server)}
+}
+
+func (r *serverRegistry) get(id string) (*Server, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	server, ok := r.servers[id]
+	return server, ok
+}
+
+// Returns whichever server ends up registered, in case someone else got there first
+func (r *serverRegistry) add(id string, server *Server) *Server {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.servers[id]; ok {
+		return existing
+	}
+	r.servers[id] = server
+	return server
+}
+
+func (r *serverRegistry) remove(id string) (*Server, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	server, ok := r.servers[id]
+	delete(r.servers, id)
+	return server, ok
+}
+
+// Copy of everything, so it can be looped over without holding the lock
+func (r *serverRegistry) all() map[string]*Server {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	servers := make(map[string]*Server, len(r.servers))
+	for id, server := range r.servers {
+		servers[id] = server
+	}
+	return servers
+}
+
 func (b *Bot) ServerFor(id string) (*Server, error) {
-	server, ok := b.servers[id]
+	server, ok := b.servers.get(id)
 	if ok {
 		return server, nil
 	}
 
+	// Not holding the lock here since looking up the guild can take a while
 	b.log.Printf("Creating new server for id %v", id)
 	server, err := NewServer(b, b.log.Writer(), id)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't create new server from id %v: %v", id, err)
 	}
 
-	b.servers[id] = server
-	return server, nil
+	return b.servers.add(id, server), nil
+}
+
+// Champion names etc. in embeds are in the server's language
+func (b *Bot) languageFor(guildID string) ddragon.Language {
+	if guildID == "" {
+		// DMs don't have a server
+		return riot.DefaultLanguage
+	}
+	server, err := b.ServerFor(guildID)
+	if err != nil {
+		b.log.Printf("Couldn't get server for guild id %v, using default language: %v", guildID, err)
+		return riot.DefaultLanguage
+	}
+	return server.Language()
 }
 
-func (b *Bot) UpdateTick(channel *discord.Channel) {
+func (b *Bot) UpdateTick(channel *discord.Channel, lang ddragon.Language) {
 	b.log.Printf("Sending update embed to channel %v", channel.Mention())
-	embeds, err := b.embedsFromVerb("all")
+	// Servers that tick around the same time with the same language get the same embeds
+	opts := statsOptions{
+		window:   windowWeek,
+		queue:    riot.QueueRanked,
+		lang:     lang,
+		priority: riot.PriorityBackground,
+		guild:    channel.GuildID,
+	}
+	// Only updates share these so nothing ever needs raising, and the lookups inside share on their own
+	embeds, err := shared(&b.shared, fmt.Sprintf("tick:%v", lang), b.newLookup(opts), func(riot.Provider) ([]*discord.MessageEmbed, error) {
+		return b.embedsFromVerb("all", opts)
+	})
 	if err != nil {
 		b.log.Printf("Couldn't get embeds for update tick: %v", err)
 	}
@@ -36,3 +112,36 @@ func (b *Bot) UpdateTick(channel *discord.Channel) {
 		b.log.Printf("Error sending update tick message: %v", err)
 	}
 }
+
+// Sent to every server with an update channel when a ranked split ends
+func (b *Bot) SplitRecap(split *riot.Split) {
+	b.log.Printf("Sending recap for split %v", split.Name)
+	// Only generate embeds once per language
+	embedsByLang := map[ddragon.Language][]*discord.MessageEmbed{}
+
+	for id, server := range b.servers.all() {
+		channel := server.Channel()
+		if channel == nil {
+			continue
+		}
+		lang := server.Language()
+		embeds, ok := embedsByLang[lang]
+		if !ok {
+			var err error
+			opts := statsOptions{queue: riot.QueueRanked, lang: lang, priority: riot.PriorityBackground, guild: id}
+			embeds, err = b.embedsSince("all", split.Start, fmt.Sprintf("in %v", split.Name), opts)
+			if err != nil {
+				b.log.Printf("Couldn't get embeds for split recap in language %v: %v", lang, err)
+				// The other languages might still work
+				continue
+			}
+			embedsByLang[lang] = embeds
+		}
+		if _, err := b.session.ChannelMessageSendComplex(channel.ID, &discord.MessageSend{
+			Content: fmt.Sprintf("**%v** is over! Here's how it went:", split.Name),
+			Embeds:  embeds,
+		}); err != nil {
+			b.log.Printf("Error sending split recap to server %v: %v", id, err)
+		}
+	}
+}
@@ -26,7 +26,10 @@ func (b *Bot) GuildByID(guildID string) (*discord.Guild, error) {
 	if err != nil {
 		return nil, err
 	}
-	b.session.State.GuildAdd(guild)
+	// The state updates guilds it already has in place, so it gets its own copy to do that to
+	// Otherwise servers holding onto this one would have it change out from under them
+	cached := *guild
+	b.session.State.GuildAdd(&cached)
 
 	return guild, nil
 }
@@ -0,0 +1,90 @@
+// Coalesces Riot lookups for the same player. Every server ticks on its own, so without this
+// a dozen servers ticking at once means a dozen copies of the same requests.
+
+package discord
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/thatliuser/simipangpang/pkg/riot"
+)
+
+// How long a result gets reused for after it comes back
+const sharedTTL = 30 * time.Second
+
+// What the other callers get if the fetch panics
+var errSharedPanic = errors.New("lookup failed unexpectedly")
+
+type sharedCall struct {
+	// Closed once value and err are set
+	done  chan struct{}
+	value any
+	err   error
+	at    time.Time
+	// What the fetch's requests go out with. Starts out as the first caller's priority, and gets
+	// raised if someone interactive joins, so a slash command never waits behind background requests.
+	priority *riot.SharedPriority
+}
+
+// Like singleflight, except successful results stick around for sharedTTL so calls that come in
+// just after the first one finishes don't start another fetch
+type sharedCalls struct {
+	mu    sync.Mutex
+	calls map[string]*sharedCall
+}
+
+// The fetch gets a client that sends requests with the shared priority, which it should use for everything
+func shared[T any](s *sharedCalls, key string, lk *lookup, fetch func(client riot.Provider) (T, error)) (T, error) {
+	s.mu.Lock()
+	if s.calls == nil {
+		s.calls = make(map[string]*sharedCall)
+	}
+	call, ok := s.calls[key]
+	if ok && !call.expired() {
+		s.mu.Unlock()
+		if lk.priority == riot.PriorityInteractive {
+			call.priority.Raise()
+		}
+		<-call.done
+		// Always the right type since the key decides what gets fetched
+		value, _ := call.value.(T)
+		return value, call.err
+	}
+	// Old results are only cleaned up here, but there's never that many of them
+	for k, c := range s.calls {
+		if c.expired() {
+			delete(s.calls, k)
+		}
+	}
+	call = &sharedCall{done: make(chan struct{}), priority: riot.NewSharedPriority(lk.priority, lk.guild)}
+	s.calls[key] = call
+	s.mu.Unlock()
+
+	// Deferred so a panicking fetch doesn't leave everyone else waiting on it forever
+	var value T
+	err := errSharedPanic
+	defer func() {
+		s.mu.Lock()
+		call.value, call.err, call.at = value, err, time.Now()
+		if err != nil && s.calls[key] == call {
+			// Errors shouldn't be reused, the next call might work
+			delete(s.calls, key)
+		}
+		s.mu.Unlock()
+		close(call.done)
+	}()
+	value, err = fetch(lk.client.PrioritizedBy(call.priority))
+	return value, err
+}
+
+// Has to be called with the lock held. Calls that are still going never expire.
+func (c *sharedCall) expired() bool {
+	select {
+	case <-c.done:
+		return c.err != nil || time.Since(c.at) > sharedTTL
+	default:
+		return false
+	}
+}
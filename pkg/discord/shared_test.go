@@ -0,0 +1,123 @@
+package discord
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thatliuser/simipangpang/pkg/riot"
+	"github.com/thatliuser/simipangpang/pkg/riot/riotfake"
+)
+
+func TestSharedPanicReleasesWaiters(t *testing.T) {
+	calls := &sharedCalls{}
+	lk := &lookup{client: riotfake.New(), priority: riot.PriorityInteractive}
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		defer func() { recover() }()
+		shared(calls, "player", lk, func(riot.Provider) (int, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	waited := make(chan error, 1)
+	go func() {
+		_, err := shared(calls, "player", lk, func(riot.Provider) (int, error) {
+			return 0, errors.New("shouldn't run, the first call is still going")
+		})
+		waited <- err
+	}()
+	// Give the waiter a chance to start waiting on the first call
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-waited:
+		if err == nil {
+			t.Fatal("waiter got no error after the fetch panicked")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter is still blocked after the fetch panicked")
+	}
+
+	// The key shouldn't be stuck either
+	value, err := shared(calls, "player", lk, func(riot.Provider) (int, error) { return 1, nil })
+	if err != nil || value != 1 {
+		t.Fatalf("got %v, %v after the panic, want 1, nil", value, err)
+	}
+}
+
+// Hangs onto the priority the shared fetch sends its requests with
+type priorityClient struct {
+	*riotfake.Client
+	priority *riot.SharedPriority
+}
+
+func (c *priorityClient) PrioritizedBy(priority *riot.SharedPriority) riot.Provider {
+	c.priority = priority
+	return c
+}
+
+func TestSharedRaisesPriority(t *testing.T) {
+	tests := []struct {
+		name  string
+		first riot.Priority
+		// Who joins while the first fetch is still going
+		joiner riot.Priority
+		want   riot.Priority
+	}{
+		{"interactive joins background", riot.PriorityBackground, riot.PriorityInteractive, riot.PriorityInteractive},
+		{"background joins background", riot.PriorityBackground, riot.PriorityBackground, riot.PriorityBackground},
+		{"background joins interactive", riot.PriorityInteractive, riot.PriorityBackground, riot.PriorityInteractive},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := &sharedCalls{}
+			client := &priorityClient{Client: riotfake.New()}
+			started := make(chan struct{})
+			release := make(chan struct{})
+			fetches := atomic.Int32{}
+			fetch := func(riot.Provider) (int, error) {
+				if fetches.Add(1) == 1 {
+					close(started)
+					<-release
+				}
+				return 1, nil
+			}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				shared(calls, "player", &lookup{client: client, priority: test.first, guild: "first"}, fetch)
+			}()
+			<-started
+			if got := client.priority.Priority(); got != test.first {
+				t.Fatalf("fetch started with priority %v, want %v", got, test.first)
+			}
+
+			joined := make(chan struct{})
+			go func() {
+				defer close(joined)
+				shared(calls, "player", &lookup{client: client, priority: test.joiner, guild: "joiner"}, fetch)
+			}()
+			// Give the joiner a chance to raise it (or not) before it starts waiting
+			time.Sleep(20 * time.Millisecond)
+			if got := client.priority.Priority(); got != test.want {
+				t.Errorf("got priority %v after joining, want %v", got, test.want)
+			}
+			close(release)
+			<-done
+			<-joined
+			// Everyone shares one fetch no matter their priority
+			if n := fetches.Load(); n != 1 {
+				t.Errorf("fetched %v times, want 1", n)
+			}
+		})
+	}
+}
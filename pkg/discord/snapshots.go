@@ -0,0 +1,236 @@
+// Last good data for each tracked player, so there's still something to show when Riot is down or rate limiting us.
+
+package discord
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Kyagara/equinox/clients/lol"
+	discord "github.com/bwmarrin/discordgo"
+	"github.com/thatliuser/simipangpang/pkg/riot"
+)
+
+type matchSnapshot struct {
+	// Everything after this was fetched
+	since   time.Time
+	matches []*riot.Match
+	at      time.Time
+}
+
+// Same as matchSnapshot, TFT only has the one queue
+type tftMatchSnapshot struct {
+	since   time.Time
+	matches []*riot.TFTMatch
+	at      time.Time
+}
+
+type snapshot struct {
+	account    *riot.Account
+	accountAt  time.Time
+	mastery    []lol.ChampionMasteryV4DTO
+	masteryAt  time.Time
+	matches    map[riot.Queue]matchSnapshot
+	tftRank    *riot.TFTRank
+	tftRankAt  time.Time
+	tftMatches *tftMatchSnapshot
+}
+
+// Keyed by PUUID
+type snapshots struct {
+	mu       sync.Mutex
+	accounts map[string]*snapshot
+}
+
+// Has to be called with the lock held
+func (s *snapshots) get(puuid string) *snapshot {
+	if s.accounts == nil {
+		s.accounts = make(map[string]*snapshot)
+	}
+	snap, ok := s.accounts[puuid]
+	if !ok {
+		snap = &snapshot{matches: make(map[riot.Queue]matchSnapshot)}
+		s.accounts[puuid] = snap
+	}
+	return snap
+}
+
+// Everything that goes into one reply
+type lookup struct {
+	// Prioritized for whoever the reply is for
+	client   riot.Provider
+	priority riot.Priority
+	guild    string
+	// The oldest snapshot that got used, so the reply can say how old it is.
+	// Zero if everything was fresh.
+	oldest time.Time
+}
+
+func (b *Bot) newLookup(opts statsOptions) *lookup {
+	return &lookup{client: b.client.Prioritized(opts.priority, opts.guild), priority: opts.priority, guild: opts.guild}
+}
+
+func (l *lookup) saw(at time.Time) {
+	if l.oldest.IsZero() || at.Before(l.oldest) {
+		l.oldest = at
+	}
+}
+
+func formatAge(age time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %v", unit)
+		}
+		return fmt.Sprintf("%v %vs", n, unit)
+	}
+	switch {
+	case age < time.Minute:
+		return "less than a minute"
+	case age < time.Hour:
+		return plural(int(age/time.Minute), "minute")
+	case age < 24*time.Hour:
+		return plural(int(age/time.Hour), "hour")
+	default:
+		return plural(int(age/(24*time.Hour)), "day")
+	}
+}
+
+// Footers don't render timestamps, so the age has to be spelled out
+func (l *lookup) mark(embeds []*discord.MessageEmbed) {
+	if l.oldest.IsZero() {
+		return
+	}
+	note := fmt.Sprintf("Couldn't reach Riot, data from %v ago", formatAge(time.Since(l.oldest)))
+	for _, embed := range embeds {
+		if embed.Footer == nil {
+			embed.Footer = &discord.MessageEmbedFooter{}
+		}
+		if embed.Footer.Text == "" {
+			embed.Footer.Text = note
+		} else {
+			embed.Footer.Text = fmt.Sprintf("%v • %v", embed.Footer.Text, note)
+		}
+	}
+}
+
+// Fetches the account, falling back to the last good one if that fails
+func (b *Bot) accountOrSnapshot(puuid string, fetch func() (*riot.Account, error), lk *lookup) (*riot.Account, error) {
+	account, err := fetch()
+	b.snapshots.mu.Lock()
+	defer b.snapshots.mu.Unlock()
+	snap := b.snapshots.get(puuid)
+	if err == nil {
+		snap.account = account
+		snap.accountAt = time.Now()
+		return account, nil
+	} else if snap.account == nil {
+		return nil, err
+	}
+	b.log.Printf("Couldn't refresh account %v, using snapshot from %v: %v", puuid, snap.accountAt, err)
+	lk.saw(snap.accountAt)
+	return snap.account, nil
+}
+
+func (b *Bot) topMasteryOrSnapshot(account *riot.Account, lk *lookup) ([]lol.ChampionMasteryV4DTO, error) {
+	top, err := shared(&b.shared, "mastery:"+account.PUUID, lk, func(client riot.Provider) ([]lol.ChampionMasteryV4DTO, error) {
+		return client.TopChampionsByMastery(account, 1)
+	})
+	b.snapshots.mu.Lock()
+	defer b.snapshots.mu.Unlock()
+	snap := b.snapshots.get(account.PUUID)
+	if err == nil {
+		snap.mastery = top
+		snap.masteryAt = time.Now()
+		return top, nil
+	} else if snap.mastery == nil {
+		return nil, err
+	}
+	b.log.Printf("Couldn't refresh mastery for %v, using snapshot from %v: %v", account.PUUID, snap.masteryAt, err)
+	lk.saw(snap.masteryAt)
+	return snap.mastery, nil
+}
+
+// The snapshot only gets used if it goes back far enough to cover the whole window
+func (b *Bot) matchesOrSnapshot(account *riot.Account, queue riot.Queue, since time.Time, lk *lookup) ([]*riot.Match, error) {
+	key := fmt.Sprintf("matches:%v:%v:%v", account.PUUID, queue, since.Unix())
+	matches, err := shared(&b.shared, key, lk, func(client riot.Provider) ([]*riot.Match, error) {
+		return client.MatchesSince(account, queue, since)
+	})
+	// Everyone gets the same slice back, and it gets sorted later
+	matches = slices.Clone(matches)
+	b.snapshots.mu.Lock()
+	defer b.snapshots.mu.Unlock()
+	snap := b.snapshots.get(account.PUUID)
+	if err == nil {
+		// Don't replace a longer window with a shorter one, unless the longer one is really out of date
+		if old, ok := snap.matches[queue]; !ok || !since.After(old.since) || time.Since(old.at) > time.Since(since) {
+			snap.matches[queue] = matchSnapshot{since: since, matches: slices.Clone(matches), at: time.Now()}
+		}
+		return matches, nil
+	}
+	old, ok := snap.matches[queue]
+	if !ok || old.since.After(since) {
+		return nil, err
+	}
+	b.log.Printf("Couldn't refresh %v matches for %v, using snapshot from %v: %v", queue.Name(), account.PUUID, old.at, err)
+	lk.saw(old.at)
+	matches = []*riot.Match{}
+	for _, match := range old.matches {
+		if !match.Time.Before(since) {
+			matches = append(matches, match)
+		}
+	}
+	return matches, nil
+}
+
+func (b *Bot) tftRankOrSnapshot(account *riot.Account, lk *lookup) (*riot.TFTRank, error) {
+	rank, err := shared(&b.shared, "tft-rank:"+account.PUUID, lk, func(client riot.Provider) (*riot.TFTRank, error) {
+		return client.TFTRankFor(account)
+	})
+	b.snapshots.mu.Lock()
+	defer b.snapshots.mu.Unlock()
+	snap := b.snapshots.get(account.PUUID)
+	if err == nil {
+		snap.tftRank = rank
+		snap.tftRankAt = time.Now()
+		return rank, nil
+	} else if snap.tftRank == nil {
+		return nil, err
+	}
+	b.log.Printf("Couldn't refresh TFT rank for %v, using snapshot from %v: %v", account.PUUID, snap.tftRankAt, err)
+	lk.saw(snap.tftRankAt)
+	return snap.tftRank, nil
+}
+
+// Same rules as matchesOrSnapshot
+func (b *Bot) tftMatchesOrSnapshot(account *riot.Account, since time.Time, lk *lookup) ([]*riot.TFTMatch, error) {
+	key := fmt.Sprintf("tft-matches:%v:%v", account.PUUID, since.Unix())
+	matches, err := shared(&b.shared, key, lk, func(client riot.Provider) ([]*riot.TFTMatch, error) {
+		return client.TFTMatchesSince(account, since)
+	})
+	matches = slices.Clone(matches)
+	b.snapshots.mu.Lock()
+	defer b.snapshots.mu.Unlock()
+	snap := b.snapshots.get(account.PUUID)
+	if err == nil {
+		if old := snap.tftMatches; old == nil || !since.After(old.since) || time.Since(old.at) > time.Since(since) {
+			snap.tftMatches = &tftMatchSnapshot{since: since, matches: slices.Clone(matches), at: time.Now()}
+		}
+		return matches, nil
+	}
+	old := snap.tftMatches
+	if old == nil || old.since.After(since) {
+		return nil, err
+	}
+	b.log.Printf("Couldn't refresh TFT matches for %v, using snapshot from %v: %v", account.PUUID, old.at, err)
+	lk.saw(old.at)
+	matches = []*riot.TFTMatch{}
+	for _, match := range old.matches {
+		if !match.Time.Before(since) {
+			matches = append(matches, match)
+		}
+	}
+	return matches, nil
+}
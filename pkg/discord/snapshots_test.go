@@ -0,0 +1,155 @@
+package discord
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thatliuser/simipangpang/pkg/riot"
+	"github.com/thatliuser/simipangpang/pkg/riot/riottest"
+)
+
+func TestTFTSnapshotFallback(t *testing.T) {
+	client := sampleClient()
+	b := newTestBot(t, client)
+	opts := statsOptions{lang: riot.DefaultLanguage, priority: riot.PriorityInteractive, puuid: samplePUUID}
+	since := sampleNow.AddDate(0, 0, -7)
+
+	if _, err := b.tftEmbedsSince("short", since, "this week", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// Riot goes down, and nothing's left over from the first lookup
+	client.Err = errors.New("riot is down")
+	b.shared = sharedCalls{}
+	embeds, err := b.tftEmbedsSince("short", since, "this week", opts)
+	if err != nil {
+		t.Fatalf("didn't fall back to the snapshot: %v", err)
+	}
+	want := "TFT stats this week • Couldn't reach Riot, data from less than a minute ago"
+	if footer := embeds[0].Footer.Text; footer != want {
+		t.Errorf("got footer %q, want %q", footer, want)
+	}
+	if embeds[0].Description != "**Silver III** / 10 LP\n" {
+		t.Errorf("got description %q from the snapshot, want the rank from before", embeds[0].Description)
+	}
+
+	// A longer window than what was saved can't come from the snapshot
+	b.shared = sharedCalls{}
+	if _, err := b.tftEmbedsSince("short", since.AddDate(0, 0, -7), "last two weeks", opts); err == nil {
+		t.Error("got embeds for a window the snapshot doesn't cover")
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	tests := []struct {
+		age  time.Duration
+		want string
+	}{
+		{0, "less than a minute"},
+		{59 * time.Second, "less than a minute"},
+		{time.Minute, "1 minute"},
+		{90 * time.Minute, "1 hour"},
+		{5 * time.Hour, "5 hours"},
+		{24 * time.Hour, "1 day"},
+		{80 * time.Hour, "3 days"},
+	}
+	for _, test := range tests {
+		if got := formatAge(test.age); got != test.want {
+			t.Errorf("formatAge(%v) got %q, want %q", test.age, got, test.want)
+		}
+	}
+}
+
+// The real client against a fake Riot API that starts failing, so the errors are the ones the bot actually sees
+func TestSnapshotFallbackFromRiotAPI(t *testing.T) {
+	since := sampleNow.AddDate(0, 0, -7)
+	opts := statsOptions{queue: riot.QueueRanked, lang: riot.DefaultLanguage, priority: riot.PriorityInteractive, puuid: samplePUUID}
+	tests := []struct {
+		name   string
+		status int
+		verb   string
+		// How old the snapshot is
+		age  time.Duration
+		want string
+	}{
+		{"server error", http.StatusInternalServerError, "all", 0, "Couldn't reach Riot, data from less than a minute ago"},
+		{"unavailable", http.StatusServiceUnavailable, "all", 3 * time.Hour, "Couldn't reach Riot, data from 3 hours ago"},
+		{"rate limited", http.StatusTooManyRequests, "all", 2 * 24 * time.Hour, "Couldn't reach Riot, data from 2 days ago"},
+		// Anything that stops a fresh fetch counts, even Riot saying the player's gone
+		{"not found", http.StatusNotFound, "all", 0, "Couldn't reach Riot, data from less than a minute ago"},
+		{"short", http.StatusInternalServerError, "short", time.Hour, "Couldn't reach Riot, data from 1 hour ago"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := riottest.NewServer(sampleScenario())
+			defer srv.Close()
+			b := newTestBot(t, riottestClient(t, srv))
+
+			if _, err := b.embedsSince(test.verb, since, "this week", opts); err != nil {
+				t.Fatal(err)
+			}
+			// Nothing should come back fresh now
+			srv.Fail(test.status)
+			b.shared = sharedCalls{}
+			snap := b.snapshots.get(samplePUUID)
+			snap.accountAt = snap.accountAt.Add(-test.age)
+			snap.masteryAt = snap.masteryAt.Add(-test.age)
+			for queue, matches := range snap.matches {
+				matches.at = matches.at.Add(-test.age)
+				snap.matches[queue] = matches
+			}
+
+			embeds, err := b.embedsSince(test.verb, since, "this week", opts)
+			if err != nil {
+				t.Fatalf("didn't fall back to the snapshot: %v", err)
+			}
+			// The note goes after whatever the footer already said
+			if footer, want := embeds[0].Footer.Text, "Account stats • "+test.want; footer != want {
+				t.Errorf("got footer %q, want %q", footer, want)
+			}
+			for _, embed := range embeds[1:] {
+				if !strings.HasSuffix(embed.Footer.Text, " • "+test.want) {
+					t.Errorf("got footer %q, want it to end with %q", embed.Footer.Text, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshotFallbackNotUsed(t *testing.T) {
+	since := sampleNow.AddDate(0, 0, -7)
+	opts := statsOptions{queue: riot.QueueRanked, lang: riot.DefaultLanguage, priority: riot.PriorityInteractive, puuid: samplePUUID}
+	srv := riottest.NewServer(sampleScenario())
+	defer srv.Close()
+	b := newTestBot(t, riottestClient(t, srv))
+
+	// Fresh data doesn't get marked
+	embeds, err := b.embedsSince("all", since, "this week", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if footer := embeds[0].Footer.Text; strings.Contains(footer, "Couldn't reach Riot") {
+		t.Errorf("fresh embed got marked as stale: %q", footer)
+	}
+
+	srv.Fail(http.StatusInternalServerError)
+	b.shared = sharedCalls{}
+	// Nothing was saved for another queue or a longer window
+	arena := opts
+	arena.queue = riot.QueueArena
+	if _, err := b.embedsSince("all", since, "this week", arena); err == nil {
+		t.Error("got embeds for a queue that was never looked up")
+	}
+	if _, err := b.embedsSince("all", since.AddDate(0, 0, -7), "last two weeks", opts); err == nil {
+		t.Error("got embeds for a window the snapshot doesn't cover")
+	}
+	// Or for someone who was never looked up at all
+	other := opts
+	other.puuid = "puuid-nobody"
+	if _, err := b.embedsSince("all", since, "this week", other); err == nil {
+		t.Error("got embeds for a player with no snapshot")
+	}
+}
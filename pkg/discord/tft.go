@@ -0,0 +1,182 @@
+// Functions that generate Discord embeds from Riot TFT info.
+
+package discord
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	discord "github.com/bwmarrin/discordgo"
+	"github.com/thatliuser/simipangpang/pkg/riot"
+)
+
+// How many traits / units to show at once
+const tftTopCount = 3
+
+func listOrNone(names []string) string {
+	if len(names) == 0 {
+		return "None"
+	}
+	return strings.Join(names, ", ")
+}
+
+func (b *Bot) tftShortEmbed(account *riot.Account, matches []*riot.TFTMatch, window string, lk *lookup) ([]*discord.MessageEmbed, error) {
+	rank, err := b.tftRankOrSnapshot(account, lk)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnail := (*discord.MessageEmbedThumbnail)(nil)
+	desc := fmt.Sprintf("**%v**\n", rank.Rank)
+	if rank.Ranked() {
+		thumbnail = &discord.MessageEmbedThumbnail{
+			URL: rank.RankURL,
+		}
+		desc = fmt.Sprintf(
+			"**%v** / %v LP\n",
+			rank.Rank, rank.Points,
+		)
+	}
+
+	return []*discord.MessageEmbed{
+		{
+			Color: 0xF7F12F,
+			Author: &discord.MessageEmbedAuthor{
+				Name:    fmt.Sprintf("%v#%v", account.Name, account.Discrim),
+				IconURL: account.IconURL,
+			},
+			Thumbnail:   thumbnail,
+			Description: desc,
+			Footer: &discord.MessageEmbedFooter{
+				Text: fmt.Sprintf("TFT stats %v", window),
+			},
+			Fields: []*discord.MessageEmbedField{
+				{
+					Name:   "Top 4s",
+					Value:  fmt.Sprint(rank.Wins),
+					Inline: true,
+				},
+				{
+					Name:   "Bottom 4s",
+					Value:  fmt.Sprint(rank.Losses),
+					Inline: true,
+				},
+				{
+					Name:   "Average placement",
+					Value:  fmt.Sprintf("%.2f (%v games)", riot.AveragePlacement(matches), len(matches)),
+					Inline: true,
+				},
+				{
+					Name:   "Top traits",
+					Value:  listOrNone(riot.TopTraits(matches, tftTopCount)),
+					Inline: false,
+				},
+				{
+					Name:   "Top units",
+					Value:  listOrNone(riot.TopUnits(matches, tftTopCount)),
+					Inline: false,
+				},
+			},
+		},
+	}, nil
+}
+
+func (b *Bot) tftMatchEmbed(account *riot.Account, match *riot.TFTMatch, caption string) ([]*discord.MessageEmbed, error) {
+	color := 0xEB4C34
+	if match.Placement <= 4 {
+		color = 0x6EEB34
+	}
+	return []*discord.MessageEmbed{
+		{
+			Color: color,
+			Author: &discord.MessageEmbedAuthor{
+				Name:    fmt.Sprintf("%v#%v", account.Name, account.Discrim),
+				IconURL: account.IconURL,
+			},
+			Description: fmt.Sprintf("**%v place** (played <t:%v:R>)", ordinal(match.Placement), match.Time.Unix()),
+			Footer: &discord.MessageEmbedFooter{
+				Text: caption,
+			},
+			Fields: []*discord.MessageEmbedField{
+				{
+					Name:   "Level",
+					Value:  fmt.Sprint(match.Level),
+					Inline: true,
+				},
+				{
+					Name:   "Traits",
+					Value:  listOrNone(match.Traits),
+					Inline: false,
+				},
+				{
+					Name:   "Units",
+					Value:  listOrNone(match.Units),
+					Inline: false,
+				},
+			},
+		},
+	}, nil
+}
+
+// Assumes matches are sorted by performance
+func (b *Bot) tftBestMatchEmbed(account *riot.Account, matches []*riot.TFTMatch, window string) ([]*discord.MessageEmbed, error) {
+	caption := fmt.Sprintf("Best TFT match %v", window)
+	if len(matches) < 1 {
+		return b.emptyMatch(account, caption)
+	}
+	return b.tftMatchEmbed(account, matches[len(matches)-1], caption)
+}
+
+// Assumes matches are sorted by performance
+func (b *Bot) tftWorstMatchEmbed(account *riot.Account, matches []*riot.TFTMatch, window string) ([]*discord.MessageEmbed, error) {
+	caption := fmt.Sprintf("Worst TFT match %v", window)
+	if len(matches) < 1 {
+		return b.emptyMatch(account, caption)
+	}
+	return b.tftMatchEmbed(account, matches[0], caption)
+}
+
+func (b *Bot) tftEmbedsFromVerb(verb string, opts statsOptions) ([]*discord.MessageEmbed, error) {
+	since, window, err := b.windowStart(opts.window)
+	if err != nil {
+		return nil, err
+	}
+	return b.tftEmbedsSince(verb, since, window, opts)
+}
+
+// Same as embedsSince
+func (b *Bot) tftEmbedsSince(verb string, since time.Time, window string, opts statsOptions) ([]*discord.MessageEmbed, error) {
+	lk := b.newLookup(opts)
+	account, err := b.accountFor(opts, lk)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := b.tftMatchesOrSnapshot(account, since, lk)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(matches, riot.CompareTFTMatches)
+
+	embedFunc := (func(*riot.Account, []*riot.TFTMatch, string) ([]*discord.MessageEmbed, error))(nil)
+	switch verb {
+	case "short":
+		embedFunc = func(account *riot.Account, matches []*riot.TFTMatch, window string) ([]*discord.MessageEmbed, error) {
+			return b.tftShortEmbed(account, matches, window, lk)
+		}
+	case "best":
+		embedFunc = b.tftBestMatchEmbed
+	case "worst":
+		embedFunc = b.tftWorstMatchEmbed
+	default:
+		return nil, fmt.Errorf("verb not recognized: %v", verb)
+	}
+
+	embeds, err := embedFunc(account, matches, window)
+	if err != nil {
+		return nil, err
+	}
+	lk.mark(embeds)
+	return embeds, nil
+}
@@ -0,0 +1,226 @@
+// Tracked players. These are keyed by PUUID so a Riot ID change doesn't lose track of anyone.
+
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	discord "github.com/bwmarrin/discordgo"
+	"github.com/thatliuser/simipangpang/pkg/riot"
+)
+
+// Bot-wide state lives here so it doesn't get mistaken for a server
+const globalDir = stateDir + "/global"
+
+type nameChange struct {
+	Name    string `json:"name"`
+	Discrim string `json:"discrim"`
+	// When the name stopped being used
+	Until time.Time `json:"until"`
+}
+
+type trackedAccount struct {
+	PUUID   string       `json:"puuid"`
+	Name    string       `json:"name"`
+	Discrim string       `json:"discrim"`
+	History []nameChange `json:"history"`
+}
+
+func (t *trackedAccount) RiotID() string {
+	return fmt.Sprintf("%v#%v", t.Name, t.Discrim)
+}
+
+// Stuff that gets JSON'ed
+type trackedState struct {
+	// PUUID of the player that gets looked up when nobody else is specified
+	Default  string                     `json:"default"`
+	Accounts map[string]*trackedAccount `json:"accounts"`
+}
+
+type trackedAccounts struct {
+	mu    sync.Mutex
+	state trackedState
+}
+
+func trackedFileName() string {
+	return fmt.Sprintf("%v/tracked%v", globalDir, saveExt)
+}
+
+func (b *Bot) loadTracked() error {
+	b.tracked.mu.Lock()
+	defer b.tracked.mu.Unlock()
+	b.tracked.state = trackedState{
+		Accounts: make(map[string]*trackedAccount),
+	}
+
+	contents, err := readFile(trackedFileName())
+	if err != nil {
+		return fmt.Errorf("couldn't open tracked accounts: %v", err)
+	} else if contents == nil {
+		// Nothing tracked yet but it's fine
+		return nil
+	}
+	if err := json.Unmarshal(contents, &b.tracked.state); err != nil {
+		return fmt.Errorf("couldn't unmarshal tracked accounts: %v", err)
+	}
+	if b.tracked.state.Accounts == nil {
+		b.tracked.state.Accounts = make(map[string]*trackedAccount)
+	}
+	return nil
+}
+
+func (b *Bot) saveTracked() error {
+	b.tracked.mu.Lock()
+	data, err := json.MarshalIndent(&b.tracked.state, "", "\t")
+	b.tracked.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("couldn't marshal tracked accounts: %v", err)
+	}
+	if err := writeFile(trackedFileName(), data); err != nil {
+		return fmt.Errorf("couldn't save tracked accounts: %v", err)
+	}
+	return nil
+}
+
+// Returns a copy so it can be read without holding the lock
+func (b *Bot) trackedByPUUID(puuid string) (trackedAccount, bool) {
+	b.tracked.mu.Lock()
+	defer b.tracked.mu.Unlock()
+	tracked, ok := b.tracked.state.Accounts[puuid]
+	if !ok {
+		return trackedAccount{}, false
+	}
+	return *tracked, true
+}
+
+// Starts tracking the account, or updates the Riot ID if it changed.
+// Returns the old name if there was a change.
+func (b *Bot) track(account *riot.Account) (*nameChange, error) {
+	b.tracked.mu.Lock()
+	tracked, ok := b.tracked.state.Accounts[account.PUUID]
+	if !ok {
+		tracked = &trackedAccount{
+			PUUID:   account.PUUID,
+			Name:    account.Name,
+			Discrim: account.Discrim,
+			History: []nameChange{},
+		}
+		b.tracked.state.Accounts[account.PUUID] = tracked
+		b.log.Printf("Tracking new account %v (%v)", tracked.RiotID(), tracked.PUUID)
+	}
+	var change *nameChange
+	if tracked.Name != account.Name || tracked.Discrim != account.Discrim {
+		change = &nameChange{
+			Name:    tracked.Name,
+			Discrim: tracked.Discrim,
+			Until:   time.Now(),
+		}
+		tracked.History = append(tracked.History, *change)
+		tracked.Name = account.Name
+		tracked.Discrim = account.Discrim
+		b.log.Printf("Account %v changed Riot ID from %v#%v to %v", tracked.PUUID, change.Name, change.Discrim, tracked.RiotID())
+	}
+	b.tracked.mu.Unlock()
+
+	if ok && change == nil {
+		// Nothing to save
+		return nil, nil
+	}
+	return change, b.saveTracked()
+}
+
+// Looks up the account and refreshes its Riot ID, announcing it if it changed.
+// Falls back to the last good account if Riot can't be reached.
+func (b *Bot) accountByPUUID(puuid string, lk *lookup) (*riot.Account, error) {
+	account, err := b.accountOrSnapshot(puuid, func() (*riot.Account, error) {
+		return shared(&b.shared, "account:"+puuid, lk, func(client riot.Provider) (*riot.Account, error) {
+			return client.AccountByPUUID(puuid)
+		})
+	}, lk)
+	if err != nil {
+		return nil, err
+	}
+	// Anyone can be looked up by Riot ID, but only players someone here cares about get tracked
+	if servers, ok := b.serversTracking(puuid); ok {
+		change, err := b.track(account)
+		if err != nil {
+			b.log.Printf("Couldn't save tracked account %v: %v", account.PUUID, err)
+		}
+		if change != nil {
+			b.announceNameChange(change, account, servers)
+		}
+	}
+	// So weekly LP gains have something to go off of
+	b.recordLP(account)
+	return account, nil
+}
+
+// The player everything defaults to (simipangpang, of course)
+func (b *Bot) defaultAccount(lk *lookup) (*riot.Account, error) {
+	b.tracked.mu.Lock()
+	puuid := b.tracked.state.Default
+	b.tracked.mu.Unlock()
+	if puuid != "" {
+		return b.accountByPUUID(puuid, lk)
+	}
+
+	// First time running, so the only thing to go off of is the Riot ID
+	account, err := lk.client.AccountByRiotID(name, discrim)
+	if err != nil {
+		return nil, err
+	}
+	b.tracked.mu.Lock()
+	b.tracked.state.Default = account.PUUID
+	b.tracked.mu.Unlock()
+	if _, err := b.track(account); err != nil {
+		b.log.Printf("Couldn't save tracked account %v: %v", account.PUUID, err)
+	}
+	return account, nil
+}
+
+// The player the stats are for
+func (b *Bot) accountFor(opts statsOptions, lk *lookup) (*riot.Account, error) {
+	if opts.puuid == "" {
+		return b.defaultAccount(lk)
+	}
+	return b.accountByPUUID(opts.puuid, lk)
+}
+
+// The servers that want to hear about the player: all of them for the default player, otherwise
+// the ones it's linked in. Returns false if that's nobody, since then it's not worth tracking.
+func (b *Bot) serversTracking(puuid string) (map[string]*Server, bool) {
+	b.tracked.mu.Lock()
+	isDefault := puuid == b.tracked.state.Default
+	b.tracked.mu.Unlock()
+	servers := b.servers.all()
+	if isDefault {
+		return servers, true
+	}
+	for id, server := range servers {
+		if !server.HasLinkTo(puuid) {
+			delete(servers, id)
+		}
+	}
+	return servers, len(servers) > 0
+}
+
+func (b *Bot) announceNameChange(change *nameChange, account *riot.Account, servers map[string]*Server) {
+	content := fmt.Sprintf(
+		"**%v#%v** is now known as **%v#%v**!",
+		change.Name, change.Discrim, account.Name, account.Discrim,
+	)
+	for id, server := range servers {
+		channel := server.Channel()
+		if channel == nil {
+			continue
+		}
+		if _, err := b.session.ChannelMessageSendComplex(channel.ID, &discord.MessageSend{
+			Content: content,
+		}); err != nil {
+			b.log.Printf("Error sending name change to server %v: %v", id, err)
+		}
+	}
+}
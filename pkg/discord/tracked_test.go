@@ -0,0 +1,96 @@
+package discord
+
+import (
+	"testing"
+
+	"github.com/thatliuser/simipangpang/pkg/riot"
+)
+
+func TestNameChangeAnnouncements(t *testing.T) {
+	client := sampleClient()
+	client.Accounts["puuid-friend"] = &riot.Account{Name: "friend", Discrim: "NA1", PUUID: "puuid-friend", Rank: "Unranked"}
+	client.Accounts["puuid-stranger"] = &riot.Account{Name: "stranger", Discrim: "NA1", PUUID: "puuid-stranger", Rank: "Unranked"}
+	b, fake := newFakeDiscordBot(t, client)
+	b.tracked.state.Default = samplePUUID
+
+	// The friend is only linked in the first guild
+	for _, guild := range []string{"guild-1", "guild-2"} {
+		fake.addChannel("channel-"+guild, guild)
+		server, err := b.ServerFor(guild)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := server.SetChannel("channel-" + guild); err != nil {
+			t.Fatal(err)
+		}
+		if guild == "guild-1" {
+			server.Link("user", "puuid-friend")
+		}
+	}
+
+	lookup := func(puuid string) {
+		t.Helper()
+		// Otherwise the last lookup gets reused
+		b.shared = sharedCalls{}
+		lk := b.newLookup(statsOptions{priority: riot.PriorityInteractive})
+		if _, err := b.accountByPUUID(puuid, lk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rename := func(puuid string, name string) {
+		renamed := *client.Accounts[puuid]
+		renamed.Name = name
+		client.Accounts[puuid] = &renamed
+	}
+	for _, puuid := range []string{samplePUUID, "puuid-friend", "puuid-stranger"} {
+		lookup(puuid)
+	}
+	if _, ok := b.trackedByPUUID("puuid-stranger"); ok {
+		t.Error("started tracking a player nobody linked")
+	}
+
+	tests := []struct {
+		name  string
+		puuid string
+		// Announcements each channel should have gotten by the end
+		want map[string]int
+	}{
+		{"linked in one guild", "puuid-friend", map[string]int{"channel-guild-1": 1, "channel-guild-2": 0}},
+		{"default player", samplePUUID, map[string]int{"channel-guild-1": 2, "channel-guild-2": 1}},
+		{"not linked anywhere", "puuid-stranger", map[string]int{"channel-guild-1": 2, "channel-guild-2": 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			old := client.Accounts[test.puuid].Name
+			rename(test.puuid, "renamed-"+old)
+			lookup(test.puuid)
+			for channel, want := range test.want {
+				if got := fake.sentTo(channel); got != want {
+					t.Errorf("%v got %v announcements, want %v", channel, got, want)
+				}
+			}
+
+			tracked, ok := b.trackedByPUUID(test.puuid)
+			if test.puuid == "puuid-stranger" {
+				if ok {
+					t.Error("started tracking a player nobody linked")
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("player isn't tracked")
+			}
+			if tracked.Name != "renamed-"+old || len(tracked.History) != 1 || tracked.History[0].Name != old {
+				t.Errorf("got %v with history %+v, want renamed-%v after %v", tracked.RiotID(), tracked.History, old, old)
+			}
+
+			// Looking them up again without another change shouldn't announce anything
+			lookup(test.puuid)
+			for channel, want := range test.want {
+				if got := fake.sentTo(channel); got != want {
+					t.Errorf("%v got %v announcements after looking up again, want %v", channel, got, want)
+				}
+			}
+		})
+	}
+}
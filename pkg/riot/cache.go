@@ -0,0 +1,229 @@
+// Response cache that sits in front of the Riot API. Equinox has one of these built in,
+// but it only supports one TTL for everything, and matches never change while league entries change constantly.
+
+package riot
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/redis/go-redis/v9"
+)
+
+type CacheStore interface {
+	// Returns nil if there's nothing there (or it expired)
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+type Endpoint string
+
+const (
+	EndpointAccount   Endpoint = "account"
+	EndpointSummoner  Endpoint = "summoner"
+	EndpointLeague    Endpoint = "league"
+	EndpointMastery   Endpoint = "mastery"
+	EndpointMatchList Endpoint = "matchlist"
+	EndpointMatch     Endpoint = "match"
+	EndpointDDragon   Endpoint = "ddragon"
+)
+
+var DefaultCacheTTLs = map[Endpoint]time.Duration{
+	EndpointAccount:   10 * time.Minute,
+	EndpointSummoner:  10 * time.Minute,
+	EndpointLeague:    2 * time.Minute,
+	EndpointMastery:   30 * time.Minute,
+	EndpointMatchList: 2 * time.Minute,
+	// Finished matches never change
+	EndpointMatch:   24 * time.Hour,
+	EndpointDDragon: time.Hour,
+}
+
+func endpointFor(path string) (Endpoint, bool) {
+	switch {
+	case strings.HasPrefix(path, "/riot/account/"):
+		return EndpointAccount, true
+	case strings.HasPrefix(path, "/lol/summoner/"), strings.HasPrefix(path, "/tft/summoner/"):
+		return EndpointSummoner, true
+	case strings.HasPrefix(path, "/lol/league/"), strings.HasPrefix(path, "/tft/league/"):
+		return EndpointLeague, true
+	case strings.HasPrefix(path, "/lol/champion-mastery/"):
+		return EndpointMastery, true
+	case strings.HasPrefix(path, "/lol/match/"), strings.HasPrefix(path, "/tft/match/"):
+		if strings.HasSuffix(path, "/ids") {
+			return EndpointMatchList, true
+		}
+		return EndpointMatch, true
+	case strings.HasPrefix(path, "/cdn/"), strings.HasPrefix(path, "/api/"):
+		return EndpointDDragon, true
+	default:
+		return "", false
+	}
+}
+
+// Parses overrides like "match=48h,league=30s" on top of the defaults
+func ParseCacheTTLs(spec string) (map[Endpoint]time.Duration, error) {
+	ttls := map[Endpoint]time.Duration{}
+	for endpoint, ttl := range DefaultCacheTTLs {
+		ttls[endpoint] = ttl
+	}
+	if spec == "" {
+		return ttls, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("cache ttl %v isn't in the form endpoint=duration", pair)
+		}
+		endpoint := Endpoint(name)
+		if _, ok := DefaultCacheTTLs[endpoint]; !ok {
+			return nil, fmt.Errorf("endpoint not recognized: %v", name)
+		}
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse cache ttl for %v: %v", name, err)
+		}
+		ttls[endpoint] = ttl
+	}
+	return ttls, nil
+}
+
+// In-memory store. Bigcache only has one lifetime for everything,
+// so the expiry for each entry gets stuck in front of the value.
+type memoryStore struct {
+	cache *bigcache.BigCache
+}
+
+func NewMemoryCache(ctx context.Context, ttls map[Endpoint]time.Duration) (CacheStore, error) {
+	longest := time.Duration(0)
+	for _, ttl := range ttls {
+		longest = max(longest, ttl)
+	}
+	cache, err := bigcache.New(ctx, bigcache.DefaultConfig(longest))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create in-memory cache: %v", err)
+	}
+	return &memoryStore{cache: cache}, nil
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	entry, err := s.cache.Get(key)
+	if errors.Is(err, bigcache.ErrEntryNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(entry) < 8 {
+		return nil, nil
+	}
+	expiry := time.Unix(0, int64(binary.BigEndian.Uint64(entry[:8])))
+	if time.Now().After(expiry) {
+		return nil, nil
+	}
+	return entry[8:], nil
+}
+
+func (s *memoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := binary.BigEndian.AppendUint64(nil, uint64(time.Now().Add(ttl).UnixNano()))
+	return s.cache.Set(key, append(entry, value...))
+}
+
+type redisStore struct {
+	client *redis.Client
+}
+
+// Takes a URL like redis://localhost:6379/0
+func NewRedisCache(ctx context.Context, url string) (CacheStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse redis url: %v", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("couldn't connect to redis at %v: %v", url, err)
+	}
+	return &redisStore{client: client}, nil
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+type noCacheKey struct{}
+
+// Requests with this context skip the cache, although what comes back still gets cached
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// Prefixed so the bot can share a Redis instance with other stuff
+const cacheKeyPrefix = "simipangpang:riot:"
+
+type cacheTransport struct {
+	store CacheStore
+	ttls  map[Endpoint]time.Duration
+	next  http.RoundTripper
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint, ok := endpointFor(req.URL.Path)
+	ttl := t.ttls[endpoint]
+	if req.Method != http.MethodGet || !ok || ttl <= 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	key := cacheKeyPrefix + req.URL.String()
+	if skip, _ := req.Context().Value(noCacheKey{}).(bool); skip {
+		return t.miss(req, key, ttl)
+	}
+	if body, err := t.store.Get(req.Context(), key); err != nil {
+		// Not fatal, the request can still go through
+		return t.miss(req, key, ttl)
+	} else if body != nil {
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"application/json"}},
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return t.miss(req, key, ttl)
+}
+
+func (t *cacheTransport) miss(req *http.Request, key string, ttl time.Duration) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		// Errors shouldn't be cached, otherwise they'd stick around after Riot recovers
+		return resp, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read response body for %v: %v", req.URL, err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	// Also not fatal
+	t.store.Set(req.Context(), key, body, ttl)
+	return resp, nil
+}
@@ -0,0 +1,86 @@
+package riot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Counts requests by path, and answers everything with just enough to get by
+type countingServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	paths map[string]int
+}
+
+func newCountingServer(t *testing.T) *countingServer {
+	s := &countingServer{paths: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.paths[r.URL.Path]++
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/versions.json" {
+			json.NewEncoder(w).Encode([]string{"14.1.1"})
+			return
+		}
+		json.NewEncoder(w).Encode([]string{})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *countingServer) count(suffix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for path, n := range s.paths {
+		if strings.HasSuffix(path, suffix) {
+			total += n
+		}
+	}
+	return total
+}
+
+// So New doesn't go looking for a real key
+func useTestKey(t *testing.T) {
+	t.Setenv(tokenEnv, "test")
+	// Setenv puts it back afterwards, Unsetenv alone wouldn't
+	t.Setenv(tokenFileEnv, "")
+	os.Unsetenv(tokenFileEnv)
+}
+
+func TestMatchListCachedAcrossSeconds(t *testing.T) {
+	useTestKey(t)
+	srv := newCountingServer(t)
+	base, _ := url.Parse(srv.URL)
+	store, err := NewMemoryCache(context.Background(), DefaultCacheTTLs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := New(5*time.Second, WithBaseURL(base), WithCache(store, DefaultCacheTTLs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := &Account{Name: "test", PUUID: "puuid"}
+	since := time.Now().AddDate(0, 0, -7).Truncate(time.Minute)
+	if _, err := client.MatchesSince(account, QueueRanked, since); err != nil {
+		t.Fatal(err)
+	}
+	// Long enough that anything based on the current time would've changed
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := client.MatchesSince(account, QueueRanked, since); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.count("/ids"); n != 1 {
+		t.Fatalf("match list was requested %v times, want 1 (the second should be cached)", n)
+	}
+}
@@ -3,7 +3,9 @@ package riot
 import (
 	"context"
 	"fmt"
-	"os"
+	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -12,33 +14,117 @@ import (
 	"github.com/Kyagara/equinox/api"
 	"github.com/Kyagara/equinox/clients/ddragon"
 	"github.com/Kyagara/equinox/clients/lol"
+	equinoxriot "github.com/Kyagara/equinox/clients/riot"
+	"github.com/Kyagara/equinox/clients/tft"
 	"github.com/rs/zerolog"
 )
 
 type Client struct {
-	client   *equinox.Equinox
-	timeout  time.Duration
-	version  string
-	region   api.RegionalRoute
-	platform lol.PlatformRoute
+	client      *equinox.Equinox
+	timeout     time.Duration
+	version     string
+	region      api.RegionalRoute
+	platform    lol.PlatformRoute
+	tftPlatform tft.PlatformRoute
+	// Shared with prioritized copies
+	catalogs *catalogs
+	keys     *keyPool
+	// Interactive if it's nil
+	priority *SharedPriority
+	uncached bool
 }
 
 const tokenEnv = "RIOT_TOKEN"
 
-func New(timeout time.Duration) (*Client, error) {
-	token, ok := os.LookupEnv(tokenEnv)
-	if !ok {
-		return nil, fmt.Errorf("couldn't lookup token for riot client (%v) in environment", tokenEnv)
+type options struct {
+	mode       Mode
+	fixtureDir string
+	baseURL    *url.URL
+	cache      CacheStore
+	cacheTTLs  map[Endpoint]time.Duration
+}
+
+type Option func(*options)
+
+// Records responses to or replays them from dir, depending on the mode
+func WithMode(mode Mode, dir string) Option {
+	return func(o *options) {
+		o.mode = mode
+		o.fixtureDir = dir
+	}
+}
+
+// Sends every request (API and CDN) to baseURL instead of Riot
+func WithBaseURL(baseURL *url.URL) Option {
+	return func(o *options) {
+		o.baseURL = baseURL
 	}
+}
+
+// Caches responses in store, for however long the endpoint's TTL is (0 means don't cache it)
+func WithCache(store CacheStore, ttls map[Endpoint]time.Duration) Option {
+	return func(o *options) {
+		o.cache = store
+		o.cacheTTLs = ttls
+	}
+}
+
+func (o *options) transport(keys *keyPool) http.RoundTripper {
+	transport := http.DefaultTransport
+	if o.baseURL != nil {
+		transport = &redirectTransport{base: o.baseURL, next: transport}
+	}
+	keys.next = transport
+	transport = keys
+	switch o.mode {
+	case ModeRecord:
+		transport = &recordTransport{dir: o.fixtureDir, next: transport}
+	case ModeReplay:
+		transport = &replayTransport{dir: o.fixtureDir}
+	}
+	transport = newScheduler(keys, transport)
+	// Cache hits don't need to wait their turn
+	if o.cache != nil {
+		transport = &cacheTransport{store: o.cache, ttls: o.cacheTTLs, next: transport}
+	}
+	return transport
+}
+
+func New(timeout time.Duration, opts ...Option) (*Client, error) {
+	o := options{
+		mode:       ModeLive,
+		fixtureDir: DefaultFixtureDir,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	tokens, err := loadKeys()
+	if err != nil {
+		if o.mode != ModeReplay {
+			return nil, err
+		}
+		// Nothing gets sent anywhere but equinox refuses to work without one
+		tokens = []string{"replay"}
+	}
+	keys := newKeyPool(tokens)
 	c := equinox.NewClientWithConfig(api.EquinoxConfig{
-		Key:      token,
+		// Gets replaced by whichever key the pool picks
+		Key:      tokens[0],
 		LogLevel: zerolog.Disabled,
+		HTTPClient: &http.Client{
+			Timeout:   timeout,
+			Transport: o.transport(keys),
+		},
 	})
 	client := &Client{
-		client:   c,
-		timeout:  timeout,
-		region:   api.AMERICAS,
-		platform: lol.NA1,
+		client:      c,
+		timeout:     timeout,
+		region:      api.AMERICAS,
+		platform:    lol.NA1,
+		tftPlatform: tft.NA1,
+		catalogs:    &catalogs{},
+		keys:        keys,
 	}
 	ctx, cancel := client.newContext()
 	defer cancel()
@@ -52,7 +138,33 @@ func New(timeout time.Duration) (*Client, error) {
 }
 
 func (r *Client) newContext() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), r.timeout)
+	ctx := context.Background()
+	if r.priority != nil {
+		ctx = withPriority(ctx, r.priority)
+	}
+	if r.uncached {
+		ctx = WithoutCache(ctx)
+	}
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+// Returns a client that sends its requests with this priority, on behalf of the guild
+func (r *Client) Prioritized(priority Priority, guild string) Provider {
+	return r.PrioritizedBy(NewSharedPriority(priority, guild))
+}
+
+// Same as Prioritized, except the priority can be raised later on
+func (r *Client) PrioritizedBy(priority *SharedPriority) Provider {
+	prioritized := *r
+	prioritized.priority = priority
+	return &prioritized
+}
+
+// Returns a client that always goes to Riot, for when a cached response could be out of date
+func (r *Client) Uncached() Provider {
+	uncached := *r
+	uncached.uncached = true
+	return &uncached
 }
 
 func (r *Client) TopChampionsByMastery(account *Account, count int32) ([]lol.ChampionMasteryV4DTO, error) {
@@ -66,21 +178,23 @@ func (r *Client) TopChampionsByMastery(account *Account, count int32) ([]lol.Cha
 	}
 }
 
-func (r *Client) ChampionByName(name string) (*ddragon.FullChampion, error) {
+func (r *Client) ChampionByName(name string, lang ddragon.Language) (*ddragon.FullChampion, error) {
+	if champ, ok := r.catalogs.champion(lang, name); ok {
+		return champ, nil
+	}
 	ctx, cancel := r.newContext()
 	defer cancel()
-	champ, err := r.client.DDragon.Champion.ByName(ctx, r.version, ddragon.EnUS, name)
+	champ, err := r.client.DDragon.Champion.ByName(ctx, r.version, lang, name)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't lookup champion by name %v: %v", name, err)
 	} else {
+		r.catalogs.setChampion(lang, champ)
 		return champ, nil
 	}
 }
 
-func (r *Client) ChampionByID(id int) (*ddragon.FullChampion, error) {
-	ctx, cancel := r.newContext()
-	defer cancel()
-	champs, err := r.client.DDragon.Champion.AllChampions(ctx, r.version, ddragon.EnUS)
+func (r *Client) ChampionByID(id int, lang ddragon.Language) (*ddragon.FullChampion, error) {
+	champs, err := r.championList(lang)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't fetch all champions: %v", err)
 	}
@@ -90,7 +204,7 @@ func (r *Client) ChampionByID(id int) (*ddragon.FullChampion, error) {
 			// Ignore this because it's invalid or doesn't match
 			continue
 		}
-		return r.ChampionByName(champ.ID)
+		return r.ChampionByName(champ.ID, lang)
 	}
 	return nil, fmt.Errorf("couldn't find champion with id %v", id)
 }
@@ -100,18 +214,61 @@ type Account struct {
 	Discrim    string
 	PUUID      string
 	SummonerID string
+	IconID     int32
 	IconURL    string
 	Rank       string
 	RankURL    string
+	Tier       string
+	Division   string
 	Wins       int32
 	Losses     int32
 	Points     int32
 }
 
+// What Rank is for players without any ranked games this split
+const unranked = "Unranked"
+
+// Unranked accounts have an empty tier and no rank emblem
+func (a *Account) Ranked() bool {
+	return a.Tier != ""
+}
+
 func (a *Account) Winrate() float64 {
+	if a.Wins+a.Losses == 0 {
+		return 0
+	}
 	return float64(a.Wins*100) / float64(a.Wins+a.Losses)
 }
 
+var (
+	tiers     = []string{"IRON", "BRONZE", "SILVER", "GOLD", "PLATINUM", "EMERALD", "DIAMOND", "MASTER", "GRANDMASTER", "CHALLENGER"}
+	divisions = []string{"IV", "III", "II", "I"}
+)
+
+// Turns the rank into one number that can be compared, where every division is worth 100 LP
+func (a *Account) RankScore() int32 {
+	tier := int32(slices.Index(tiers, a.Tier))
+	if tier < 0 {
+		return 0
+	}
+	master := int32(slices.Index(tiers, "MASTER"))
+	if tier >= master {
+		// Master and up don't have divisions and LP just keeps going
+		return master*400 + a.Points
+	}
+	division := int32(max(slices.Index(divisions, a.Division), 0))
+	return tier*400 + division*100 + a.Points
+}
+
+// Human readable rank and the URL for its emblem
+func rankStrings(tier string, division string) (string, string) {
+	// Convert to not screaming case
+	tier = fmt.Sprintf("%v%v", tier[0:1], strings.ToLower(tier[1:]))
+	rank := fmt.Sprintf("%v %v", tier, division)
+	rankURL := fmt.Sprintf("https://raw.communitydragon.org/latest/plugins/rcp-fe-lol-shared-components/global/default/%v.png", strings.ToLower(tier))
+	return rank, rankURL
+}
+
 func (r *Client) AccountByRiotID(name string, discrim string) (*Account, error) {
 	ctx, cancel := r.newContext()
 	defer cancel()
@@ -119,36 +276,65 @@ func (r *Client) AccountByRiotID(name string, discrim string) (*Account, error)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't lookup user by name %v#%v: %v", name, discrim, err)
 	}
+	return r.accountFromUser(ctx, user)
+}
+
+// Only goes to Account-V1, for when the rest of the account gets looked up by PUUID later anyway
+func (r *Client) PUUIDByRiotID(name string, discrim string) (string, error) {
+	ctx, cancel := r.newContext()
+	defer cancel()
+	user, err := r.client.Riot.AccountV1.ByRiotID(ctx, r.region, name, discrim)
+	if err != nil {
+		return "", fmt.Errorf("couldn't lookup user by name %v#%v: %v", name, discrim, err)
+	}
+	return user.PUUID, nil
+}
+
+// Riot IDs can change but PUUIDs can't, so this is preferred when the PUUID is known
+func (r *Client) AccountByPUUID(puuid string) (*Account, error) {
+	ctx, cancel := r.newContext()
+	defer cancel()
+	user, err := r.client.Riot.AccountV1.ByPUUID(ctx, r.region, puuid)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't lookup user by puuid %v: %v", puuid, err)
+	}
+	return r.accountFromUser(ctx, user)
+}
+
+func (r *Client) accountFromUser(ctx context.Context, user *equinoxriot.AccountV1DTO) (*Account, error) {
 	summoner, err := r.client.LOL.SummonerV4.ByPUUID(ctx, r.platform, user.PUUID)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't lookup summoner by puuid %v: %v", user.PUUID, err)
 	}
-	iconURL := fmt.Sprintf("https://ddragon.leagueoflegends.com/cdn/%v/img/profileicon/%v.png", r.version, summoner.ProfileIconID)
 	leagues, err := r.client.LOL.LeagueV4.SummonerEntries(ctx, r.platform, summoner.ID)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't lookup leagues for summoner by id %v: %v", summoner.ID, err)
 	}
-	if len(leagues) < 1 {
-		return nil, fmt.Errorf("user is not ranked (league length is 0)")
-	}
-	league := leagues[0]
-	tier := string(league.Tier)
-	// Convert to not screaming case
-	tier = fmt.Sprintf("%v%v", tier[0:1], strings.ToLower(tier[1:]))
-	rank := fmt.Sprintf("%v %v", tier, league.Rank)
-	rankURL := fmt.Sprintf("https://raw.communitydragon.org/latest/plugins/rcp-fe-lol-shared-components/global/default/%v.png", strings.ToLower(tier))
-	return &Account{
+	account := &Account{
 		Name:       user.GameName,
 		Discrim:    user.TagLine,
 		PUUID:      user.PUUID,
 		SummonerID: summoner.ID,
-		IconURL:    iconURL,
-		Rank:       rank,
-		RankURL:    rankURL,
-		Wins:       league.Wins,
-		Losses:     league.Losses,
-		Points:     league.LeaguePoints,
-	}, nil
+		IconID:     summoner.ProfileIconID,
+		IconURL:    r.IconURLForProfileIcon(summoner.ProfileIconID),
+		Rank:       unranked,
+	}
+	if len(leagues) < 1 {
+		// Unranked players still have an account, they just don't have a rank to show
+		return account, nil
+	}
+	league := leagues[0]
+	account.Rank, account.RankURL = rankStrings(string(league.Tier), string(league.Rank))
+	account.Tier = string(league.Tier)
+	account.Division = string(league.Rank)
+	account.Wins = league.Wins
+	account.Losses = league.Losses
+	account.Points = league.LeaguePoints
+	return account, nil
+}
+
+func (r *Client) IconURLForProfileIcon(id int32) string {
+	return fmt.Sprintf("https://ddragon.leagueoflegends.com/cdn/%v/img/profileicon/%v.png", r.version, id)
 }
 
 func (r *Client) IconURLForChamp(champ *ddragon.FullChampion) string {
@@ -170,7 +356,7 @@ func (r *Client) MasteryForChamp(account *Account, champ *ddragon.FullChampion)
 	}
 }
 
-func (r *Client) matchesByIDs(account *Account, ids []string) ([]*Match, error) {
+func (r *Client) matchesByIDs(account *Account, queue Queue, ids []string) ([]*Match, error) {
 	ctx, cancel := r.newContext()
 	defer cancel()
 	matches := []*Match{}
@@ -199,32 +385,55 @@ func (r *Client) matchesByIDs(account *Account, ids []string) ([]*Match, error)
 		}
 		// Convert from ms to s (the timestamp is in ms)
 		time := time.Unix(info.Info.GameCreation/1000, 0)
+		items := []int32{}
+		for _, item := range []int32{player.Item0, player.Item1, player.Item2, player.Item3, player.Item4, player.Item5, player.Item6} {
+			if item != 0 {
+				items = append(items, item)
+			}
+		}
+		keystone := int32(0)
+		if styles := player.Perks.Styles; len(styles) > 0 && len(styles[0].Selections) > 0 {
+			// The first selection of the primary tree is always the keystone
+			keystone = styles[0].Selections[0].Perk
+		}
 
 		matches = append(matches, &Match{
-			Kills:   player.Kills,
-			Deaths:  player.Deaths,
-			Assists: player.Assists,
-			Won:     player.Win,
-			Champ:   player.ChampionID,
-			Time:    time,
+			ID:        id,
+			Kills:     player.Kills,
+			Deaths:    player.Deaths,
+			Assists:   player.Assists,
+			Won:       player.Win,
+			Champ:     player.ChampionID,
+			Time:      time,
+			Queue:     queue,
+			Placement: player.Placement,
+			Items:     items,
+			Keystone:  keystone,
+			Spells:    []int32{player.Summoner1ID, player.Summoner2ID},
 		})
 	}
 	return matches, nil
 }
 
 func (r *Client) RankedMatchesSince(account *Account, since time.Time) ([]*Match, error) {
+	return r.MatchesSince(account, QueueRanked, since)
+}
+
+func (r *Client) MatchesSince(account *Account, queue Queue, since time.Time) ([]*Match, error) {
 	ctx, cancel := r.newContext()
 	defer cancel()
 	start := since.Unix()
-	end := time.Now().Unix()
+	queueID, queueType := queue.listArgs()
+	// No end time (-1) means up to now. Sending the current time instead would change the URL
+	// every second, so the match list would never come out of the cache.
 	ids, err := r.client.LOL.MatchV5.ListByPUUID(
 		ctx, r.region, account.PUUID,
-		start, end, -1, "ranked", 0, 100,
+		start, -1, queueID, queueType, 0, 100,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't get match history for %v: %v", account.Name, err)
+		return nil, fmt.Errorf("couldn't get %v match history for %v: %v", queue.Name(), account.Name, err)
 	}
-	matches, err := r.matchesByIDs(account, ids)
+	matches, err := r.matchesByIDs(account, queue, ids)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't lookup matches by ids: %v", err)
 	} else {
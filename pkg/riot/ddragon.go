@@ -0,0 +1,270 @@
+// Data Dragon catalogs. These only change with the version, so they're cached per language.
+
+package riot
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Kyagara/equinox/api"
+	"github.com/Kyagara/equinox/clients/ddragon"
+)
+
+const DefaultLanguage = ddragon.EnUS
+
+var Languages = []ddragon.Language{
+	ddragon.EnUS, ddragon.CsCZ, ddragon.DeDE, ddragon.ElGR, ddragon.EnAU, ddragon.EnGB, ddragon.EnPH,
+	ddragon.EnSG, ddragon.EsAR, ddragon.EsES, ddragon.EsMX, ddragon.FrFR, ddragon.HuHU, ddragon.IdID,
+	ddragon.ItIT, ddragon.JaJP, ddragon.KoKR, ddragon.PlPL, ddragon.PtBR, ddragon.RoRO, ddragon.RuRU,
+	ddragon.ThTH, ddragon.TrTR, ddragon.ViVN, ddragon.ZhCN, ddragon.ZhMY, ddragon.ZhTW,
+}
+
+// Accepts both Data Dragon (en_US) and Discord (en-US) style locales
+func ParseLanguage(lang string) (ddragon.Language, error) {
+	normalized := strings.ReplaceAll(lang, "-", "_")
+	for _, l := range Languages {
+		if strings.EqualFold(string(l), normalized) {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("language not supported by data dragon: %v", lang)
+}
+
+type Item struct {
+	ID    int
+	Name  string
+	Image string
+}
+
+type Rune struct {
+	ID   int
+	Name string
+	// Path relative to the image root, like perk-images/Styles/...
+	Icon string
+}
+
+type SummonerSpell struct {
+	ID    int
+	Name  string
+	Image string
+}
+
+// Keyed by numeric ID
+type catalog[T any] map[ddragon.Language]map[int]T
+
+type catalogs struct {
+	mu sync.Mutex
+	// Keyed by champion ID (the name without spaces, like MonkeyKing)
+	champList map[ddragon.Language]map[string]ddragon.AllChampionsDataDTO
+	champs    map[ddragon.Language]map[string]*ddragon.FullChampion
+	items     catalog[Item]
+	runes     catalog[Rune]
+	spells    catalog[SummonerSpell]
+}
+
+func (c *catalogs) champion(lang ddragon.Language, name string) (*ddragon.FullChampion, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	champ, ok := c.champs[lang][name]
+	return champ, ok
+}
+
+func (c *catalogs) setChampion(lang ddragon.Language, champ *ddragon.FullChampion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.champs == nil {
+		c.champs = make(map[ddragon.Language]map[string]*ddragon.FullChampion)
+	}
+	if c.champs[lang] == nil {
+		c.champs[lang] = make(map[string]*ddragon.FullChampion)
+	}
+	c.champs[lang][champ.ID] = champ
+}
+
+func (r *Client) championList(lang ddragon.Language) (map[string]ddragon.AllChampionsDataDTO, error) {
+	r.catalogs.mu.Lock()
+	champs, ok := r.catalogs.champList[lang]
+	r.catalogs.mu.Unlock()
+	if ok {
+		return champs, nil
+	}
+
+	ctx, cancel := r.newContext()
+	defer cancel()
+	champs, err := r.client.DDragon.Champion.AllChampions(ctx, r.version, lang)
+	if err != nil {
+		return nil, err
+	}
+
+	r.catalogs.mu.Lock()
+	defer r.catalogs.mu.Unlock()
+	if r.catalogs.champList == nil {
+		r.catalogs.champList = make(map[ddragon.Language]map[string]ddragon.AllChampionsDataDTO)
+	}
+	r.catalogs.champList[lang] = champs
+	return champs, nil
+}
+
+// Equinox only knows about champions so the rest have to be fetched by hand
+func (r *Client) fetchDDragon(id string, path string, target any) error {
+	ctx, cancel := r.newContext()
+	defer cancel()
+	logger := r.client.Internal.Logger(id)
+	req, err := r.client.Internal.Request(ctx, logger, api.D_DRAGON_BASE_URL_FORMAT, http.MethodGet, "", path, "", nil)
+	if err != nil {
+		return fmt.Errorf("couldn't create request for %v: %v", path, err)
+	}
+	if err := r.client.Internal.Execute(ctx, req, target); err != nil {
+		return fmt.Errorf("couldn't fetch %v: %v", path, err)
+	}
+	return nil
+}
+
+// Gets the catalog for the language from the cache, or fetches it if it's not there yet
+func lookupCatalog[T any](r *Client, cat *catalog[T], lang ddragon.Language, fetch func() (map[int]T, error)) (map[int]T, error) {
+	r.catalogs.mu.Lock()
+	entries, ok := (*cat)[lang]
+	r.catalogs.mu.Unlock()
+	if ok {
+		return entries, nil
+	}
+
+	entries, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	r.catalogs.mu.Lock()
+	defer r.catalogs.mu.Unlock()
+	if *cat == nil {
+		*cat = make(catalog[T])
+	}
+	(*cat)[lang] = entries
+	return entries, nil
+}
+
+type ddragonImage struct {
+	Full string `json:"full"`
+}
+
+func (r *Client) Item(id int, lang ddragon.Language) (*Item, error) {
+	items, err := lookupCatalog(r, &r.catalogs.items, lang, func() (map[int]Item, error) {
+		data := struct {
+			Data map[string]struct {
+				Name  string       `json:"name"`
+				Image ddragonImage `json:"image"`
+			} `json:"data"`
+		}{}
+		if err := r.fetchDDragon("DDragon_Item_All", fmt.Sprintf("/cdn/%v/data/%v/item.json", r.version, lang), &data); err != nil {
+			return nil, err
+		}
+		items := map[int]Item{}
+		for key, item := range data.Data {
+			id, err := strconv.Atoi(key)
+			if err != nil {
+				// Ignore this because it's invalid
+				continue
+			}
+			items[id] = Item{ID: id, Name: item.Name, Image: item.Image.Full}
+		}
+		return items, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch all items: %v", err)
+	}
+	item, ok := items[id]
+	if !ok {
+		return nil, fmt.Errorf("couldn't find item with id %v", id)
+	}
+	return &item, nil
+}
+
+func (r *Client) Rune(id int, lang ddragon.Language) (*Rune, error) {
+	runes, err := lookupCatalog(r, &r.catalogs.runes, lang, func() (map[int]Rune, error) {
+		type ddragonRune struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+			Icon string `json:"icon"`
+		}
+		// The trees themselves (Domination etc.) count as runes too since they show up in matches
+		data := []struct {
+			ID    int    `json:"id"`
+			Name  string `json:"name"`
+			Icon  string `json:"icon"`
+			Slots []struct {
+				Runes []ddragonRune `json:"runes"`
+			} `json:"slots"`
+		}{}
+		if err := r.fetchDDragon("DDragon_Rune_All", fmt.Sprintf("/cdn/%v/data/%v/runesReforged.json", r.version, lang), &data); err != nil {
+			return nil, err
+		}
+		runes := map[int]Rune{}
+		for _, tree := range data {
+			runes[tree.ID] = Rune{ID: tree.ID, Name: tree.Name, Icon: tree.Icon}
+			for _, slot := range tree.Slots {
+				for _, perk := range slot.Runes {
+					runes[perk.ID] = Rune{ID: perk.ID, Name: perk.Name, Icon: perk.Icon}
+				}
+			}
+		}
+		return runes, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch all runes: %v", err)
+	}
+	perk, ok := runes[id]
+	if !ok {
+		return nil, fmt.Errorf("couldn't find rune with id %v", id)
+	}
+	return &perk, nil
+}
+
+func (r *Client) SummonerSpell(id int, lang ddragon.Language) (*SummonerSpell, error) {
+	spells, err := lookupCatalog(r, &r.catalogs.spells, lang, func() (map[int]SummonerSpell, error) {
+		data := struct {
+			Data map[string]struct {
+				Name  string       `json:"name"`
+				Key   string       `json:"key"`
+				Image ddragonImage `json:"image"`
+			} `json:"data"`
+		}{}
+		if err := r.fetchDDragon("DDragon_Spell_All", fmt.Sprintf("/cdn/%v/data/%v/summoner.json", r.version, lang), &data); err != nil {
+			return nil, err
+		}
+		spells := map[int]SummonerSpell{}
+		for _, spell := range data.Data {
+			// Matches use the key, not the ID (which is like SummonerFlash)
+			id, err := strconv.Atoi(spell.Key)
+			if err != nil {
+				// Ignore this because it's invalid
+				continue
+			}
+			spells[id] = SummonerSpell{ID: id, Name: spell.Name, Image: spell.Image.Full}
+		}
+		return spells, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch all summoner spells: %v", err)
+	}
+	spell, ok := spells[id]
+	if !ok {
+		return nil, fmt.Errorf("couldn't find summoner spell with id %v", id)
+	}
+	return &spell, nil
+}
+
+func (r *Client) IconURLForItem(item *Item) string {
+	return fmt.Sprintf("https://ddragon.leagueoflegends.com/cdn/%v/img/item/%v", r.version, item.Image)
+}
+
+// Runes aren't versioned for some reason
+func (r *Client) IconURLForRune(perk *Rune) string {
+	return fmt.Sprintf("https://ddragon.leagueoflegends.com/cdn/img/%v", perk.Icon)
+}
+
+func (r *Client) IconURLForSpell(spell *SummonerSpell) string {
+	return fmt.Sprintf("https://ddragon.leagueoflegends.com/cdn/%v/img/spell/%v", r.version, spell.Image)
+}
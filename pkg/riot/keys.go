@@ -0,0 +1,312 @@
+// Riot API key handling. Development keys expire every day, so keys can be swapped out while the bot is running.
+// Bigger deployments can use several keys at once to get more out of the rate limit.
+
+package riot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const tokenFileEnv = "RIOT_TOKEN_FILE"
+
+// How often the token file gets checked for changes
+const keyFilePollInterval = 30 * time.Second
+
+// Every key is allowed to use this one, so a 403 from it means the key itself is bad
+const keyProbeURL = "https://na1.api.riotgames.com/lol/status/v4/platform-data"
+
+// Called when Riot stops accepting a key, with the status it sent back and how many working keys are left.
+// The key is masked so it can be logged.
+type KeyRejectedFunc func(key string, status int, left int)
+
+type apiKey struct {
+	key    string
+	limits rateLimits
+	// Set once Riot rejects it, so it stops getting used until the keys change
+	revoked bool
+}
+
+// Only shows the end of the key, so it's safe to put in logs
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return "..." + key[len(key)-4:]
+}
+
+// Spreads requests across every key, tracking each one's rate limits separately.
+// Equinox bakes its key into every request when it's created, so it gets overwritten here instead.
+type keyPool struct {
+	mu   sync.Mutex
+	keys []*apiKey
+	// Breaks ties between keys that are equally used
+	cursor     int
+	onRejected KeyRejectedFunc
+	next       http.RoundTripper
+}
+
+// Keys can be separated by commas or newlines
+func parseKeys(keys string) []string {
+	parsed := []string{}
+	for _, key := range strings.FieldsFunc(keys, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if key = strings.TrimSpace(key); key != "" {
+			parsed = append(parsed, key)
+		}
+	}
+	return parsed
+}
+
+func newKeyPool(keys []string) *keyPool {
+	p := &keyPool{}
+	p.setKeys(keys)
+	return p
+}
+
+// Keys that stay keep their rate limits, but everything gets another chance
+func (p *keyPool) setKeys(keys []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	old := map[string]*apiKey{}
+	for _, k := range p.keys {
+		old[k.key] = k
+	}
+	p.keys = []*apiKey{}
+	for _, key := range keys {
+		k, ok := old[key]
+		if !ok {
+			k = &apiKey{key: key}
+		}
+		k.revoked = false
+		p.keys = append(p.keys, k)
+	}
+	p.cursor = 0
+}
+
+// Picks the least used key that hasn't been revoked or tried already. Keys that are out of budget
+// (like right after a Retry-After) only get picked if nothing else is left. Has to be called with the lock held.
+func (p *keyPool) pick(tried map[*apiKey]bool) *apiKey {
+	best, fallback := (*apiKey)(nil), (*apiKey)(nil)
+	for i := range p.keys {
+		k := p.keys[(p.cursor+i)%len(p.keys)]
+		if k.revoked || tried[k] {
+			continue
+		}
+		if !k.limits.hasBudget(0) {
+			if fallback == nil || k.limits.usage() < fallback.limits.usage() {
+				fallback = k
+			}
+			continue
+		}
+		if best == nil || k.limits.usage() < best.limits.usage() {
+			best = k
+		}
+	}
+	p.cursor++
+	if best == nil {
+		return fallback
+	}
+	return best
+}
+
+// Whether any usable key has more than reserve of its limits left
+func (p *keyPool) hasBudget(reserve float64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	usable := false
+	for _, k := range p.keys {
+		if k.revoked {
+			continue
+		}
+		usable = true
+		if k.limits.hasBudget(reserve) {
+			return true
+		}
+	}
+	// Nothing left to ration if every key is dead, so let requests through to fail
+	return !usable
+}
+
+func (p *keyPool) resets() []time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	resets := []time.Time{}
+	for _, k := range p.keys {
+		if !k.revoked {
+			resets = append(resets, k.limits.resets()...)
+		}
+	}
+	return resets
+}
+
+func (p *keyPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	if endpoint, _ := endpointFor(req.URL.Path); endpoint == EndpointDDragon {
+		// Data Dragon doesn't need a key
+		return p.next.RoundTrip(req)
+	}
+
+	tried := map[*apiKey]bool{}
+	for {
+		p.mu.Lock()
+		k := p.pick(tried)
+		if k == nil && len(tried) == 0 && len(p.keys) > 0 {
+			// Every key is revoked, but one of them might've come back
+			k = p.keys[0]
+		}
+		if k != nil {
+			k.limits.count()
+		}
+		p.mu.Unlock()
+		if k == nil {
+			return nil, fmt.Errorf("every riot api key was rejected")
+		}
+		tried[k] = true
+
+		attempt := req.Clone(req.Context())
+		attempt.Header.Set("X-Riot-Token", k.key)
+		resp, err := p.next.RoundTrip(attempt)
+		if err != nil {
+			return resp, err
+		}
+		p.mu.Lock()
+		k.limits.update(resp.Header)
+		p.mu.Unlock()
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+		case http.StatusForbidden:
+			// Expired keys get a 403, but so do endpoints the key isn't allowed to use.
+			// Revoking on those would go through every key one after the other, so check first.
+			if !p.probe(req.Context(), k) {
+				return resp, nil
+			}
+		default:
+			return resp, nil
+		}
+		if !p.reject(k, resp.StatusCode) || req.Body != nil {
+			// Nothing else to try, or no way to send the body again
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+}
+
+// Returns whether Riot rejects the key on an endpoint any key can use. If the probe itself fails,
+// the key gets the benefit of the doubt.
+func (p *keyPool) probe(ctx context.Context, k *apiKey) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, keyProbeURL, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("X-Riot-Token", k.key)
+	p.mu.Lock()
+	k.limits.count()
+	p.mu.Unlock()
+	resp, err := p.next.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	p.mu.Lock()
+	k.limits.update(resp.Header)
+	p.mu.Unlock()
+	return resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden
+}
+
+// Returns whether there's another key to try
+func (p *keyPool) reject(k *apiKey, status int) bool {
+	p.mu.Lock()
+	alert := !k.revoked
+	k.revoked = true
+	left := 0
+	for _, other := range p.keys {
+		if !other.revoked {
+			left++
+		}
+	}
+	onRejected := p.onRejected
+	p.mu.Unlock()
+	// Only alert once per key, not on every request. It's in the background since the alert
+	// probably goes out over the network, and Riot requests shouldn't wait on that.
+	if alert && onRejected != nil {
+		go onRejected(maskKey(k.key), status, left)
+	}
+	return left > 0
+}
+
+// The token file wins over the environment, since that's the one that can change
+func loadKeys() ([]string, error) {
+	if path, ok := os.LookupEnv(tokenFileEnv); ok {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read riot token file: %v", err)
+		}
+		keys := parseKeys(string(contents))
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("riot token file %v is empty", path)
+		}
+		return keys, nil
+	}
+	keys := parseKeys(os.Getenv(tokenEnv))
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("couldn't lookup token for riot client (%v or %v) in environment", tokenEnv, tokenFileEnv)
+	}
+	return keys, nil
+}
+
+// Swaps out the API keys for every request from now on. Several keys can be separated by commas.
+func (r *Client) SetKey(keys string) error {
+	parsed := parseKeys(keys)
+	if len(parsed) == 0 {
+		return fmt.Errorf("no riot api keys given")
+	}
+	r.keys.setKeys(parsed)
+	return nil
+}
+
+// Rereads the keys from wherever they came from at startup
+func (r *Client) ReloadKey() error {
+	keys, err := loadKeys()
+	if err != nil {
+		return err
+	}
+	r.keys.setKeys(keys)
+	return nil
+}
+
+func (r *Client) OnKeyRejected(onRejected KeyRejectedFunc) {
+	r.keys.mu.Lock()
+	defer r.keys.mu.Unlock()
+	r.keys.onRejected = onRejected
+}
+
+// Reloads the key whenever the token file changes, until ctx is done. Does nothing without a token file.
+func (r *Client) WatchKeyFile(ctx context.Context, onReload func(err error)) {
+	path, ok := os.LookupEnv(tokenFileEnv)
+	if !ok {
+		return
+	}
+	modTime := time.Time{}
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+	ticker := time.NewTicker(keyFilePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil || !info.ModTime().After(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+			onReload(r.ReloadKey())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
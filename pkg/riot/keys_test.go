@@ -0,0 +1,184 @@
+package riot
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Answers every request with the status set for the key it was sent with
+type keyStatuses map[string]int
+
+func (k keyStatuses) RoundTrip(req *http.Request) (*http.Response, error) {
+	status, ok := k[req.Header.Get("X-Riot-Token")]
+	if !ok {
+		status = http.StatusOK
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+func sendThrough(t *testing.T, pool *keyPool) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "https://na1.api.riotgames.com/lol/summoner/v4/summoners/by-puuid/x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := pool.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestPickSkipsBlockedKeys(t *testing.T) {
+	pool := newKeyPool([]string{"blocked", "fine"})
+	pool.keys[0].limits.blockedUntil = time.Now().Add(time.Minute)
+	// Less used than the other key, which shouldn't matter while it's blocked
+	pool.keys[1].limits.windows = map[int]*rateWindow{
+		1: {length: time.Second, reset: time.Now().Add(time.Second), limit: 10, count: 5},
+	}
+
+	for i := 0; i < 4; i++ {
+		if k := pool.pick(map[*apiKey]bool{}); k == nil || k.key != "fine" {
+			t.Fatalf("picked %v, want the key that isn't blocked", k)
+		}
+	}
+
+	// If it's the only one left it still gets used
+	pool.keys[1].revoked = true
+	if k := pool.pick(map[*apiKey]bool{}); k == nil || k.key != "blocked" {
+		t.Fatalf("picked %v, want the blocked key as a last resort", k)
+	}
+}
+
+// Answers the key probe separately from everything else
+type probeStatuses struct {
+	endpoint keyStatuses
+	probe    keyStatuses
+}
+
+func (p probeStatuses) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.String() == keyProbeURL {
+		return p.probe.RoundTrip(req)
+	}
+	return p.endpoint.RoundTrip(req)
+}
+
+func TestForbidden(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport probeStatuses
+		// What the request ends up with
+		status int
+		// Which keys should be revoked by the end
+		revoked []string
+	}{
+		{
+			"expired key",
+			probeStatuses{
+				endpoint: keyStatuses{"first": http.StatusForbidden},
+				probe:    keyStatuses{"first": http.StatusForbidden},
+			},
+			http.StatusOK,
+			[]string{"first"},
+		},
+		{
+			"every key expired",
+			probeStatuses{
+				endpoint: keyStatuses{"first": http.StatusForbidden, "second": http.StatusForbidden},
+				probe:    keyStatuses{"first": http.StatusForbidden, "second": http.StatusForbidden},
+			},
+			http.StatusForbidden,
+			[]string{"first", "second"},
+		},
+		{
+			"endpoint off limits",
+			probeStatuses{
+				endpoint: keyStatuses{"first": http.StatusForbidden, "second": http.StatusForbidden},
+				probe:    keyStatuses{},
+			},
+			http.StatusForbidden,
+			[]string{},
+		},
+		{
+			"probe fails",
+			probeStatuses{
+				endpoint: keyStatuses{"first": http.StatusForbidden},
+				probe:    keyStatuses{"first": http.StatusServiceUnavailable},
+			},
+			http.StatusForbidden,
+			[]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool := newKeyPool([]string{"first", "second"})
+			pool.next = test.transport
+			// Make sure the first key goes first
+			pool.keys[1].limits.windows = map[int]*rateWindow{
+				1: {length: time.Second, reset: time.Now().Add(time.Second), limit: 10, count: 5},
+			}
+			rejected := make(chan string, 2)
+			pool.onRejected = func(key string, status int, left int) { rejected <- key }
+
+			if resp := sendThrough(t, pool); resp.StatusCode != test.status {
+				t.Fatalf("got status %v, want %v", resp.StatusCode, test.status)
+			}
+			revoked := []string{}
+			for _, k := range pool.keys {
+				if k.revoked {
+					revoked = append(revoked, k.key)
+				}
+			}
+			if strings.Join(revoked, ",") != strings.Join(test.revoked, ",") {
+				t.Fatalf("got keys %v revoked, want %v", revoked, test.revoked)
+			}
+			for range test.revoked {
+				select {
+				case <-rejected:
+				case <-time.After(time.Second):
+					t.Fatal("no alert for a revoked key")
+				}
+			}
+			select {
+			case key := <-rejected:
+				t.Fatalf("key %v was reported as rejected without being revoked", key)
+			case <-time.After(10 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestUnauthorizedRevokesAndRetries(t *testing.T) {
+	pool := newKeyPool([]string{"bad", "good"})
+	pool.next = keyStatuses{"bad": http.StatusUnauthorized}
+	// Make sure the bad key goes first
+	pool.keys[1].limits.windows = map[int]*rateWindow{
+		1: {length: time.Second, reset: time.Now().Add(time.Second), limit: 10, count: 5},
+	}
+	rejected := make(chan string, 1)
+	pool.onRejected = func(key string, status int, left int) { rejected <- key }
+
+	if resp := sendThrough(t, pool); resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %v, want the request retried with the good key", resp.StatusCode)
+	}
+	if !pool.keys[0].revoked || pool.keys[1].revoked {
+		t.Fatal("only the key that got a 401 should be revoked")
+	}
+	select {
+	case key := <-rejected:
+		if key != maskKey("bad") {
+			t.Fatalf("got alert for %v, want %v", key, maskKey("bad"))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no alert for the rejected key")
+	}
+}
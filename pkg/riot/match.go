@@ -5,12 +5,21 @@ package riot
 import "time"
 
 type Match struct {
+	// Riot's match ID, like NA1_1234567890
+	ID      string
 	Kills   int32
 	Deaths  int32
 	Assists int32
 	Won     bool
 	Champ   int32
 	Time    time.Time
+	Queue   Queue
+	// Only set for queues with placements (1 is first)
+	Placement int32
+	// Final build, without empty slots
+	Items    []int32
+	Keystone int32
+	Spells   []int32
 }
 
 func (m *Match) KillDeathRatio() float64 {
@@ -23,7 +32,17 @@ func (m *Match) KillDeathRatio() float64 {
 // 0 if one == two
 // 1 if one > two
 func CompareMatches(one, two *Match) int {
-	// First compare kills
+	// Placements trump everything else if there are any
+	if one.Queue.HasPlacements() && two.Queue.HasPlacements() && one.Placement != two.Placement {
+		// Lower is better here
+		if one.Placement > two.Placement {
+			return -1
+		} else {
+			return 1
+		}
+	}
+
+	// Then compare kills
 	if one.Kills < two.Kills {
 		return -1
 	} else if one.Kills > two.Kills {
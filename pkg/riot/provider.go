@@ -0,0 +1,37 @@
+// Everything the bot needs from Riot, so it can be swapped out for a fake (see riotfake).
+
+package riot
+
+import (
+	"time"
+
+	"github.com/Kyagara/equinox/clients/ddragon"
+	"github.com/Kyagara/equinox/clients/lol"
+)
+
+type Provider interface {
+	AccountByRiotID(name string, discrim string) (*Account, error)
+	PUUIDByRiotID(name string, discrim string) (string, error)
+	AccountByPUUID(puuid string) (*Account, error)
+	TopChampionsByMastery(account *Account, count int32) ([]lol.ChampionMasteryV4DTO, error)
+	ChampionByID(id int, lang ddragon.Language) (*ddragon.FullChampion, error)
+	IconURLForProfileIcon(id int32) string
+	IconURLForChamp(champ *ddragon.FullChampion) string
+	Item(id int, lang ddragon.Language) (*Item, error)
+	Rune(id int, lang ddragon.Language) (*Rune, error)
+	SummonerSpell(id int, lang ddragon.Language) (*SummonerSpell, error)
+	IconURLForItem(item *Item) string
+	IconURLForRune(perk *Rune) string
+	IconURLForSpell(spell *SummonerSpell) string
+	MatchesSince(account *Account, queue Queue, since time.Time) ([]*Match, error)
+	TFTRankFor(account *Account) (*TFTRank, error)
+	TFTMatchesSince(account *Account, since time.Time) ([]*TFTMatch, error)
+	// Same provider, but its requests get scheduled with this priority
+	Prioritized(priority Priority, guild string) Provider
+	// Same, but the priority can be raised while its requests are waiting
+	PrioritizedBy(priority *SharedPriority) Provider
+	// Same provider, but it doesn't use any cached responses
+	Uncached() Provider
+}
+
+var _ Provider = (*Client)(nil)
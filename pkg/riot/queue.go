@@ -0,0 +1,64 @@
+// Queues that matches can be looked up by.
+
+package riot
+
+import "fmt"
+
+type Queue string
+
+const (
+	QueueRanked Queue = "ranked"
+	QueueNormal Queue = "normal"
+	QueueARAM   Queue = "aram"
+	QueueArena  Queue = "arena"
+)
+
+var Queues = []Queue{QueueRanked, QueueNormal, QueueARAM, QueueArena}
+
+// Queue IDs from https://static.developer.riotgames.com/docs/lol/queues.json
+const (
+	aramQueueID  = 450
+	arenaQueueID = 1700
+)
+
+func ParseQueue(queue string) (Queue, error) {
+	if queue == "" {
+		return QueueRanked, nil
+	}
+	for _, q := range Queues {
+		if string(q) == queue {
+			return q, nil
+		}
+	}
+	return "", fmt.Errorf("queue not recognized: %v", queue)
+}
+
+// Human readable name, used in captions
+func (q Queue) Name() string {
+	switch q {
+	case QueueARAM:
+		return "ARAM"
+	case QueueArena:
+		return "Arena"
+	default:
+		return string(q)
+	}
+}
+
+// Arguments for MatchV5.ListByPUUID. Riot groups ranked and normal queues by type,
+// but ARAM and Arena only have queue IDs.
+func (q Queue) listArgs() (int32, string) {
+	switch q {
+	case QueueARAM:
+		return aramQueueID, ""
+	case QueueArena:
+		return arenaQueueID, ""
+	default:
+		return -1, string(q)
+	}
+}
+
+// Arena has placements instead of a plain win or loss
+func (q Queue) HasPlacements() bool {
+	return q == QueueArena
+}
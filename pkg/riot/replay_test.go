@@ -0,0 +1,133 @@
+package riot_test
+
+import (
+	"flag"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kyagara/equinox/clients/ddragon"
+	"github.com/Kyagara/equinox/clients/lol"
+	equinoxriot "github.com/Kyagara/equinox/clients/riot"
+	"github.com/thatliuser/simipangpang/pkg/riot"
+	"github.com/thatliuser/simipangpang/pkg/riot/riottest"
+)
+
+var update = flag.Bool("update", false, "record the replay fixtures in testdata again (from riottest, not the real API)")
+
+const fixtureDir = "testdata/replay"
+
+// When the fixtures were recorded
+var recordedAt = time.Date(2024, 3, 10, 20, 0, 0, 0, time.UTC)
+
+// What the fixtures were recorded from
+func recordedScenario() riottest.Scenario {
+	ago := func(hours int) int64 { return recordedAt.Add(-time.Duration(hours) * time.Hour).UnixMilli() }
+	match := func(id string, queue int32, created int64, player lol.ParticipantV5DTO) lol.MatchV5DTO {
+		player.PUUID = "puuid-simi"
+		return lol.MatchV5DTO{
+			Metadata: lol.MetadataV5DTO{MatchID: id, Participants: []string{"puuid-simi"}},
+			Info:     lol.InfoV5DTO{QueueID: queue, GameCreation: created, Participants: []lol.ParticipantV5DTO{player}},
+		}
+	}
+	return riottest.Scenario{
+		Version:   "14.5.1",
+		Accounts:  []equinoxriot.AccountV1DTO{{PUUID: "puuid-simi", GameName: "simipangpang", TagLine: "NA1"}},
+		Summoners: []lol.SummonerV4DTO{{PUUID: "puuid-simi", ID: "summoner-simi", ProfileIconID: 4568}},
+		Leagues: map[string][]lol.LeagueEntryV4DTO{
+			"summoner-simi": {{QueueType: "RANKED_SOLO_5x5", Tier: "GOLD", Rank: "II", Wins: 30, Losses: 20, LeaguePoints: 45}},
+		},
+		Champions: []ddragon.FullChampion{{ID: "Ahri", Key: "103", Name: "Ahri"}},
+		Matches: []lol.MatchV5DTO{
+			match("NA1_2", 420, ago(30), lol.ParticipantV5DTO{ChampionID: 103, Kills: 2, Deaths: 7, Assists: 3}),
+			match("NA1_1", 420, ago(5), lol.ParticipantV5DTO{ChampionID: 103, Kills: 10, Deaths: 2, Assists: 8, Win: true}),
+		},
+	}
+}
+
+// Records the fixtures from riottest with -update, otherwise replays what's checked in
+func replayClient(t *testing.T) *riot.Client {
+	t.Helper()
+	// Replaying shouldn't need a key at all
+	for _, env := range []string{"RIOT_TOKEN", "RIOT_TOKEN_FILE"} {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+	if *update {
+		srv := riottest.NewServer(recordedScenario())
+		t.Cleanup(srv.Close)
+		if err := os.RemoveAll(fixtureDir); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("RIOT_TOKEN", "record")
+		client, err := riot.New(5*time.Second, riot.WithBaseURL(srv.BaseURL()), riot.WithMode(riot.ModeRecord, fixtureDir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+	client, err := riot.New(5*time.Second, riot.WithMode(riot.ModeReplay, fixtureDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestReplayFixtures(t *testing.T) {
+	client := replayClient(t)
+
+	account, err := client.AccountByRiotID("simipangpang", "NA1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.PUUID != "puuid-simi" || account.Rank != "Gold II" || account.Points != 45 {
+		t.Errorf("got account %v (%v, %v LP), want puuid-simi (Gold II, 45 LP)", account.PUUID, account.Rank, account.Points)
+	}
+
+	// The time window isn't part of the fixture, so this replays no matter when it runs
+	since := time.Now().AddDate(0, 0, -7)
+	if *update {
+		// riottest does filter by it though
+		since = recordedAt.AddDate(0, 0, -7)
+	}
+	matches, err := client.MatchesSince(account, riot.QueueRanked, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Newest first
+	kills := []int32{}
+	for _, match := range matches {
+		kills = append(kills, match.Kills)
+	}
+	if want := []int32{10, 2}; !slices.Equal(kills, want) {
+		t.Errorf("got matches with %v kills, want %v", kills, want)
+	}
+	if len(matches) > 0 && !matches[0].Won {
+		t.Errorf("got first match %+v, want a win", matches[0])
+	}
+
+	champ, err := client.ChampionByID(103, riot.DefaultLanguage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if champ.Name != "Ahri" {
+		t.Errorf("got champion %v, want Ahri", champ.Name)
+	}
+}
+
+func TestReplayMissingFixture(t *testing.T) {
+	if *update {
+		t.Skip("nothing to check while recording")
+	}
+	client := replayClient(t)
+
+	_, err := client.AccountByRiotID("nobody", "NA1")
+	if err == nil {
+		t.Fatal("got an account that was never recorded")
+	}
+	if !strings.Contains(err.Error(), "no fixture recorded") || !strings.Contains(err.Error(), "/by-riot-id/nobody/NA1") {
+		t.Errorf("error doesn't say which request is missing: %v", err)
+	}
+}
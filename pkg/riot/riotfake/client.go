@@ -0,0 +1,206 @@
+// Package riotfake is an in-memory riot.Provider, for exercising the bot without any HTTP at all.
+
+package riotfake
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kyagara/equinox/clients/ddragon"
+	"github.com/Kyagara/equinox/clients/lol"
+	"github.com/thatliuser/simipangpang/pkg/riot"
+)
+
+// Everything except champions is keyed by PUUID
+type Client struct {
+	Accounts   map[string]*riot.Account
+	Masteries  map[string][]lol.ChampionMasteryV4DTO
+	Champions  []ddragon.FullChampion
+	Items      map[int]riot.Item
+	Runes      map[int]riot.Rune
+	Spells     map[int]riot.SummonerSpell
+	Matches    map[string][]*riot.Match
+	TFTRanks   map[string]*riot.TFTRank
+	TFTMatches map[string][]*riot.TFTMatch
+	// Returned from every method if it's set
+	Err error
+}
+
+var _ riot.Provider = (*Client)(nil)
+
+func New() *Client {
+	return &Client{
+		Accounts:   make(map[string]*riot.Account),
+		Masteries:  make(map[string][]lol.ChampionMasteryV4DTO),
+		Champions:  []ddragon.FullChampion{},
+		Items:      make(map[int]riot.Item),
+		Runes:      make(map[int]riot.Rune),
+		Spells:     make(map[int]riot.SummonerSpell),
+		Matches:    make(map[string][]*riot.Match),
+		TFTRanks:   make(map[string]*riot.TFTRank),
+		TFTMatches: make(map[string][]*riot.TFTMatch),
+	}
+}
+
+func (c *Client) AccountByRiotID(name string, discrim string) (*riot.Account, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	for _, account := range c.Accounts {
+		if strings.EqualFold(account.Name, name) && strings.EqualFold(account.Discrim, discrim) {
+			return account, nil
+		}
+	}
+	return nil, fmt.Errorf("couldn't lookup user by name %v#%v: not found", name, discrim)
+}
+
+func (c *Client) PUUIDByRiotID(name string, discrim string) (string, error) {
+	account, err := c.AccountByRiotID(name, discrim)
+	if err != nil {
+		return "", err
+	}
+	return account.PUUID, nil
+}
+
+func (c *Client) AccountByPUUID(puuid string) (*riot.Account, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	account, ok := c.Accounts[puuid]
+	if !ok {
+		return nil, fmt.Errorf("couldn't lookup user by puuid %v: not found", puuid)
+	}
+	return account, nil
+}
+
+func (c *Client) TopChampionsByMastery(account *riot.Account, count int32) ([]lol.ChampionMasteryV4DTO, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	masteries := slices.Clone(c.Masteries[account.PUUID])
+	slices.SortFunc(masteries, func(one, two lol.ChampionMasteryV4DTO) int {
+		return int(two.ChampionPoints - one.ChampionPoints)
+	})
+	return masteries[:min(int(count), len(masteries))], nil
+}
+
+// Doesn't bother with translations, every language gets the same names
+func (c *Client) ChampionByID(id int, lang ddragon.Language) (*ddragon.FullChampion, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	for _, champ := range c.Champions {
+		if champ.Key == strconv.Itoa(id) {
+			return &champ, nil
+		}
+	}
+	return nil, fmt.Errorf("couldn't find champion with id %v", id)
+}
+
+func (c *Client) IconURLForProfileIcon(id int32) string {
+	return fmt.Sprintf("https://example.com/profileicon/%v.png", id)
+}
+
+func (c *Client) IconURLForChamp(champ *ddragon.FullChampion) string {
+	return fmt.Sprintf("https://example.com/champion/%v.png", champ.ID)
+}
+
+func (c *Client) Item(id int, lang ddragon.Language) (*riot.Item, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	item, ok := c.Items[id]
+	if !ok {
+		return nil, fmt.Errorf("couldn't find item with id %v", id)
+	}
+	return &item, nil
+}
+
+func (c *Client) Rune(id int, lang ddragon.Language) (*riot.Rune, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	perk, ok := c.Runes[id]
+	if !ok {
+		return nil, fmt.Errorf("couldn't find rune with id %v", id)
+	}
+	return &perk, nil
+}
+
+func (c *Client) SummonerSpell(id int, lang ddragon.Language) (*riot.SummonerSpell, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	spell, ok := c.Spells[id]
+	if !ok {
+		return nil, fmt.Errorf("couldn't find summoner spell with id %v", id)
+	}
+	return &spell, nil
+}
+
+func (c *Client) IconURLForItem(item *riot.Item) string {
+	return fmt.Sprintf("https://example.com/item/%v", item.Image)
+}
+
+func (c *Client) IconURLForRune(perk *riot.Rune) string {
+	return fmt.Sprintf("https://example.com/rune/%v", perk.Icon)
+}
+
+func (c *Client) IconURLForSpell(spell *riot.SummonerSpell) string {
+	return fmt.Sprintf("https://example.com/spell/%v", spell.Image)
+}
+
+func (c *Client) MatchesSince(account *riot.Account, queue riot.Queue, since time.Time) ([]*riot.Match, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	matches := []*riot.Match{}
+	for _, match := range c.Matches[account.PUUID] {
+		if match.Queue == queue && !match.Time.Before(since) {
+			matches = append(matches, match)
+		}
+	}
+	return matches, nil
+}
+
+func (c *Client) TFTRankFor(account *riot.Account) (*riot.TFTRank, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	rank, ok := c.TFTRanks[account.PUUID]
+	if !ok {
+		// Same as the real client
+		return &riot.TFTRank{Rank: "Unranked"}, nil
+	}
+	return rank, nil
+}
+
+func (c *Client) TFTMatchesSince(account *riot.Account, since time.Time) ([]*riot.TFTMatch, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	matches := []*riot.TFTMatch{}
+	for _, match := range c.TFTMatches[account.PUUID] {
+		if !match.Time.Before(since) {
+			matches = append(matches, match)
+		}
+	}
+	return matches, nil
+}
+
+// Nothing gets rate limited here so there's nothing to prioritize
+func (c *Client) Prioritized(priority riot.Priority, guild string) riot.Provider {
+	return c
+}
+
+func (c *Client) PrioritizedBy(priority *riot.SharedPriority) riot.Provider {
+	return c
+}
+
+// Nothing gets cached here either
+func (c *Client) Uncached() riot.Provider {
+	return c
+}
@@ -0,0 +1,401 @@
+// Package riottest runs a fake Riot API in-process, so the bot can be exercised end to end without network access.
+// Point a client at it with riot.WithBaseURL(server.BaseURL()).
+
+package riottest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Kyagara/equinox/clients/ddragon"
+	"github.com/Kyagara/equinox/clients/lol"
+	"github.com/Kyagara/equinox/clients/riot"
+	"github.com/Kyagara/equinox/clients/tft"
+	simi "github.com/thatliuser/simipangpang/pkg/riot"
+)
+
+// Everything the fake API knows about. Leagues are keyed by summoner ID, masteries by PUUID.
+type Scenario struct {
+	Version    string
+	Accounts   []riot.AccountV1DTO
+	Summoners  []lol.SummonerV4DTO
+	Leagues    map[string][]lol.LeagueEntryV4DTO
+	TFTLeagues map[string][]tft.LeagueEntryV1DTO
+	Masteries  map[string][]lol.ChampionMasteryV4DTO
+	Matches    []lol.MatchV5DTO
+	TFTMatches []tft.MatchV1DTO
+	Champions  []ddragon.FullChampion
+	Items      []simi.Item
+	Runes      []simi.Rune
+	Spells     []simi.SummonerSpell
+}
+
+type Server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	scenario Scenario
+	// Every API (not CDN) request fails with this if it's set
+	status int
+	// Same, but only for requests under the path
+	pathStatus map[string]int
+}
+
+func NewServer(scenario Scenario) *Server {
+	s := &Server{scenario: scenario}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *Server) BaseURL() *url.URL {
+	// httptest always gives back a valid URL
+	u, _ := url.Parse(s.URL)
+	return u
+}
+
+// Change the scenario while the server is running, e.g. to rename an account
+func (s *Server) Update(update func(*Scenario)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.scenario)
+}
+
+// Make every API request fail with the status code, or pass 0 to go back to normal
+func (s *Server) Fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// Make API requests under the path fail with the status code, or pass 0 to go back to normal
+func (s *Server) FailOn(prefix string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pathStatus == nil {
+		s.pathStatus = map[string]int{}
+	}
+	if status == 0 {
+		delete(s.pathStatus, prefix)
+		return
+	}
+	s.pathStatus[prefix] = status
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func notFound(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]any{
+		"status": map[string]any{
+			"message":     "Data not found",
+			"status_code": http.StatusNotFound,
+		},
+	})
+}
+
+// Splits the path into segments after the prefix, or returns false if it doesn't match
+func route(path string, prefix string) ([]string, bool) {
+	if !strings.HasPrefix(path, prefix) {
+		return nil, false
+	}
+	rest := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	if rest == "" {
+		return []string{}, true
+	}
+	return strings.Split(rest, "/"), true
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := r.URL.Path
+	isCDN := path == "/api/versions.json" || strings.HasPrefix(path, "/cdn/")
+	if !isCDN && s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	for prefix, status := range s.pathStatus {
+		if strings.HasPrefix(path, prefix) {
+			w.WriteHeader(status)
+			return
+		}
+	}
+
+	if path == "/api/versions.json" {
+		writeJSON(w, []string{s.scenario.Version})
+	} else if args, ok := route(path, "/cdn/"); ok {
+		s.handleDDragon(w, args)
+	} else if path == "/lol/status/v4/platform-data" {
+		// Only used to check keys, so nothing's ever down
+		writeJSON(w, map[string]any{
+			"id":           "NA1",
+			"name":         "North America",
+			"locales":      []string{"en_US"},
+			"maintenances": []any{},
+			"incidents":    []any{},
+		})
+	} else if args, ok := route(path, "/riot/account/v1/accounts/"); ok {
+		s.handleAccount(w, args)
+	} else if args, ok := route(path, "/lol/summoner/v4/summoners/by-puuid/"); ok && len(args) == 1 {
+		idx := slices.IndexFunc(s.scenario.Summoners, func(summoner lol.SummonerV4DTO) bool {
+			return summoner.PUUID == args[0]
+		})
+		if idx == -1 {
+			notFound(w)
+			return
+		}
+		writeJSON(w, s.scenario.Summoners[idx])
+	} else if args, ok := route(path, "/lol/league/v4/entries/by-summoner/"); ok && len(args) == 1 {
+		writeJSON(w, orEmpty(s.scenario.Leagues[args[0]]))
+	} else if args, ok := route(path, "/tft/league/v1/entries/by-summoner/"); ok && len(args) == 1 {
+		writeJSON(w, orEmpty(s.scenario.TFTLeagues[args[0]]))
+	} else if args, ok := route(path, "/lol/champion-mastery/v4/champion-masteries/by-puuid/"); ok {
+		s.handleMastery(w, r, args)
+	} else if args, ok := route(path, "/lol/match/v5/matches/"); ok {
+		s.handleMatches(w, r, args)
+	} else if args, ok := route(path, "/tft/match/v1/matches/"); ok {
+		s.handleTFTMatches(w, r, args)
+	} else {
+		notFound(w)
+	}
+}
+
+// Riot returns [] instead of null
+func orEmpty[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
+
+func (s *Server) handleDDragon(w http.ResponseWriter, args []string) {
+	// <version>/data/<language>/champion.json or <version>/data/<language>/champion/<name>.json
+	if len(args) < 4 || args[1] != "data" {
+		notFound(w)
+		return
+	}
+	if len(args) == 4 && args[3] == "champion.json" {
+		champs := map[string]ddragon.AllChampionsDataDTO{}
+		for _, champ := range s.scenario.Champions {
+			champs[champ.ID] = ddragon.AllChampionsDataDTO{
+				ID:   champ.ID,
+				Key:  champ.Key,
+				Name: champ.Name,
+			}
+		}
+		writeJSON(w, ddragon.AllChampionsDTO{Data: champs})
+		return
+	}
+	if len(args) == 4 && args[3] == "item.json" {
+		items := map[string]any{}
+		for _, item := range s.scenario.Items {
+			items[strconv.Itoa(item.ID)] = map[string]any{
+				"name":  item.Name,
+				"image": map[string]any{"full": item.Image},
+			}
+		}
+		writeJSON(w, map[string]any{"data": items})
+		return
+	}
+	if len(args) == 4 && args[3] == "summoner.json" {
+		spells := map[string]any{}
+		for _, spell := range s.scenario.Spells {
+			spells[spell.Image] = map[string]any{
+				"name":  spell.Name,
+				"key":   strconv.Itoa(spell.ID),
+				"image": map[string]any{"full": spell.Image},
+			}
+		}
+		writeJSON(w, map[string]any{"data": spells})
+		return
+	}
+	if len(args) == 4 && args[3] == "runesReforged.json" {
+		// Everything's a tree with no slots, it gets flattened anyways
+		trees := []any{}
+		for _, perk := range s.scenario.Runes {
+			trees = append(trees, map[string]any{
+				"id":   perk.ID,
+				"name": perk.Name,
+				"icon": perk.Icon,
+			})
+		}
+		writeJSON(w, trees)
+		return
+	}
+	if len(args) == 5 && args[3] == "champion" {
+		id := strings.TrimSuffix(args[4], ".json")
+		idx := slices.IndexFunc(s.scenario.Champions, func(champ ddragon.FullChampion) bool {
+			return champ.ID == id
+		})
+		if idx == -1 {
+			notFound(w)
+			return
+		}
+		writeJSON(w, ddragon.FullChampionData{
+			Data: map[string]ddragon.FullChampion{id: s.scenario.Champions[idx]},
+		})
+		return
+	}
+	notFound(w)
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, args []string) {
+	match := func(riot.AccountV1DTO) bool { return false }
+	if len(args) == 2 && args[0] == "by-puuid" {
+		match = func(account riot.AccountV1DTO) bool {
+			return account.PUUID == args[1]
+		}
+	} else if len(args) == 3 && args[0] == "by-riot-id" {
+		match = func(account riot.AccountV1DTO) bool {
+			// Riot IDs are case insensitive
+			return strings.EqualFold(account.GameName, args[1]) && strings.EqualFold(account.TagLine, args[2])
+		}
+	}
+	idx := slices.IndexFunc(s.scenario.Accounts, match)
+	if idx == -1 {
+		notFound(w)
+		return
+	}
+	writeJSON(w, s.scenario.Accounts[idx])
+}
+
+func (s *Server) handleMastery(w http.ResponseWriter, r *http.Request, args []string) {
+	if len(args) < 1 {
+		notFound(w)
+		return
+	}
+	masteries := slices.Clone(s.scenario.Masteries[args[0]])
+	slices.SortFunc(masteries, func(one, two lol.ChampionMasteryV4DTO) int {
+		return int(two.ChampionPoints - one.ChampionPoints)
+	})
+	switch {
+	case len(args) == 1:
+		writeJSON(w, orEmpty(masteries))
+	case len(args) == 2 && args[1] == "top":
+		count := 3
+		if n, err := strconv.Atoi(r.URL.Query().Get("count")); err == nil {
+			count = n
+		}
+		writeJSON(w, orEmpty(masteries[:min(count, len(masteries))]))
+	case len(args) == 3 && args[1] == "by-champion":
+		id, _ := strconv.ParseInt(args[2], 10, 64)
+		idx := slices.IndexFunc(masteries, func(mastery lol.ChampionMasteryV4DTO) bool {
+			return mastery.ChampionID == id
+		})
+		if idx == -1 {
+			notFound(w)
+			return
+		}
+		writeJSON(w, masteries[idx])
+	default:
+		notFound(w)
+	}
+}
+
+// Applies the start and count query parameters that every match list endpoint has
+func paginate(ids []string, r *http.Request) []string {
+	start, count := 0, 20
+	if n, err := strconv.Atoi(r.URL.Query().Get("start")); err == nil {
+		start = n
+	}
+	if n, err := strconv.Atoi(r.URL.Query().Get("count")); err == nil {
+		count = n
+	}
+	if start > len(ids) {
+		return []string{}
+	}
+	return ids[start:min(start+count, len(ids))]
+}
+
+// Riot's times are in seconds for filtering but milliseconds in the match itself
+func inWindow(r *http.Request, createdMs int64) bool {
+	created := createdMs / 1000
+	if start, err := strconv.ParseInt(r.URL.Query().Get("startTime"), 10, 64); err == nil && created < start {
+		return false
+	}
+	if end, err := strconv.ParseInt(r.URL.Query().Get("endTime"), 10, 64); err == nil && created > end {
+		return false
+	}
+	return true
+}
+
+// Queue IDs that count for the type query parameter
+var queueTypes = map[string][]int32{
+	"ranked": {420, 440},
+	"normal": {400, 430, 490},
+}
+
+func (s *Server) handleMatches(w http.ResponseWriter, r *http.Request, args []string) {
+	if len(args) == 3 && args[0] == "by-puuid" && args[2] == "ids" {
+		queue, hasQueue := r.URL.Query().Get("queue"), r.URL.Query().Has("queue")
+		queueType := r.URL.Query().Get("type")
+		ids := []string{}
+		// Newest first like the real thing
+		for i := len(s.scenario.Matches) - 1; i >= 0; i-- {
+			match := s.scenario.Matches[i]
+			if !slices.Contains(match.Metadata.Participants, args[1]) || !inWindow(r, match.Info.GameCreation) {
+				continue
+			}
+			if hasQueue && queue != strconv.Itoa(int(match.Info.QueueID)) {
+				continue
+			}
+			if queueType != "" && !slices.Contains(queueTypes[queueType], match.Info.QueueID) {
+				continue
+			}
+			ids = append(ids, match.Metadata.MatchID)
+		}
+		writeJSON(w, paginate(ids, r))
+		return
+	}
+	if len(args) == 1 {
+		idx := slices.IndexFunc(s.scenario.Matches, func(match lol.MatchV5DTO) bool {
+			return match.Metadata.MatchID == args[0]
+		})
+		if idx == -1 {
+			notFound(w)
+			return
+		}
+		writeJSON(w, s.scenario.Matches[idx])
+		return
+	}
+	notFound(w)
+}
+
+func (s *Server) handleTFTMatches(w http.ResponseWriter, r *http.Request, args []string) {
+	if len(args) == 3 && args[0] == "by-puuid" && args[2] == "ids" {
+		ids := []string{}
+		for i := len(s.scenario.TFTMatches) - 1; i >= 0; i-- {
+			match := s.scenario.TFTMatches[i]
+			if !slices.Contains(match.Metadata.Participants, args[1]) || !inWindow(r, match.Info.GameDatetime) {
+				continue
+			}
+			ids = append(ids, match.Metadata.MatchID)
+		}
+		writeJSON(w, paginate(ids, r))
+		return
+	}
+	if len(args) == 1 {
+		idx := slices.IndexFunc(s.scenario.TFTMatches, func(match tft.MatchV1DTO) bool {
+			return match.Metadata.MatchID == args[0]
+		})
+		if idx == -1 {
+			notFound(w)
+			return
+		}
+		writeJSON(w, s.scenario.TFTMatches[idx])
+		return
+	}
+	notFound(w)
+}
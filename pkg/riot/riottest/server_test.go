@@ -0,0 +1,430 @@
+package riottest_test
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Kyagara/equinox/clients/ddragon"
+	"github.com/Kyagara/equinox/clients/lol"
+	"github.com/Kyagara/equinox/clients/riot"
+	"github.com/Kyagara/equinox/clients/tft"
+	simi "github.com/thatliuser/simipangpang/pkg/riot"
+	"github.com/thatliuser/simipangpang/pkg/riot/riottest"
+)
+
+var now = time.Date(2024, 3, 10, 20, 0, 0, 0, time.UTC)
+
+func ago(hours int) int64 {
+	return now.Add(-time.Duration(hours) * time.Hour).UnixMilli()
+}
+
+func match(id string, queue int32, created int64, player lol.ParticipantV5DTO) lol.MatchV5DTO {
+	return lol.MatchV5DTO{
+		Metadata: lol.MetadataV5DTO{MatchID: id, Participants: []string{player.PUUID}},
+		Info:     lol.InfoV5DTO{QueueID: queue, GameCreation: created, Participants: []lol.ParticipantV5DTO{player}},
+	}
+}
+
+func tftMatch(id string, queue int32, created int64, player tft.ParticipantV1DTO) tft.MatchV1DTO {
+	return tft.MatchV1DTO{
+		Metadata: tft.MetadataV1DTO{MatchID: id, Participants: []string{player.PUUID}},
+		Info:     tft.InfoV1DTO{QueueID: queue, GameDatetime: created, Participants: []tft.ParticipantV1DTO{player}},
+	}
+}
+
+// One ranked player with a few games, and one who hasn't played ranked at all
+func scenario() riottest.Scenario {
+	return riottest.Scenario{
+		Version: "14.5.1",
+		Accounts: []riot.AccountV1DTO{
+			{PUUID: "puuid-simi", GameName: "simipangpang", TagLine: "NA1"},
+			{PUUID: "puuid-newbie", GameName: "newbie", TagLine: "NA1"},
+		},
+		Summoners: []lol.SummonerV4DTO{
+			{PUUID: "puuid-simi", ID: "summoner-simi", ProfileIconID: 4568},
+			{PUUID: "puuid-newbie", ID: "summoner-newbie", ProfileIconID: 29},
+		},
+		Leagues: map[string][]lol.LeagueEntryV4DTO{
+			"summoner-simi": {{QueueType: "RANKED_SOLO_5x5", Tier: "GOLD", Rank: "II", Wins: 30, Losses: 20, LeaguePoints: 45}},
+		},
+		TFTLeagues: map[string][]tft.LeagueEntryV1DTO{
+			"summoner-simi": {
+				{QueueType: tft.RANKED_TFT_DOUBLE_UP, Tier: "DIAMOND", Rank: "I", Wins: 5, Losses: 1, LeaguePoints: 99},
+				{QueueType: tft.RANKED_TFT, Tier: "SILVER", Rank: "III", Wins: 12, Losses: 8, LeaguePoints: 10},
+			},
+		},
+		Masteries: map[string][]lol.ChampionMasteryV4DTO{
+			"puuid-simi": {{ChampionID: 222, ChampionPoints: 12000}, {ChampionID: 103, ChampionPoints: 250000}},
+		},
+		Champions: []ddragon.FullChampion{
+			{ID: "Ahri", Key: "103", Name: "Ahri"},
+			{ID: "Jinx", Key: "222", Name: "Jinx"},
+		},
+		Items:  []simi.Item{{ID: 3089, Name: "Rabadon's Deathcap", Image: "3089.png"}},
+		Runes:  []simi.Rune{{ID: 8112, Name: "Electrocute", Icon: "perk-images/Styles/Domination/Electrocute/Electrocute.png"}},
+		Spells: []simi.SummonerSpell{{ID: 4, Name: "Flash", Image: "SummonerFlash.png"}},
+		// Oldest first, the server hands them back newest first
+		Matches: []lol.MatchV5DTO{
+			match("NA1_1", 420, ago(24*10), lol.ParticipantV5DTO{PUUID: "puuid-simi", ChampionID: 103, Kills: 30, Win: true}),
+			match("NA1_2", 450, ago(10), lol.ParticipantV5DTO{PUUID: "puuid-simi", ChampionID: 222, Kills: 15, Deaths: 9, Assists: 30, Win: true}),
+			match("NA1_3", 420, ago(30), lol.ParticipantV5DTO{PUUID: "puuid-simi", ChampionID: 222, Kills: 2, Deaths: 7, Assists: 3}),
+			match("NA1_4", 420, ago(5), lol.ParticipantV5DTO{
+				PUUID: "puuid-simi", ChampionID: 103, Kills: 10, Deaths: 2, Assists: 8, Win: true,
+				Item0: 3089, Summoner1ID: 4, Summoner2ID: 14,
+				Perks: lol.PerksV5DTO{Styles: []lol.PerkStyleV5DTO{{Selections: []lol.PerkStyleSelectionV5DTO{{Perk: 8112}}}}},
+			}),
+			match("NA1_5", 420, ago(50), lol.ParticipantV5DTO{PUUID: "puuid-simi", ChampionID: 222, GameEndedInEarlySurrender: true}),
+		},
+		TFTMatches: []tft.MatchV1DTO{
+			tftMatch("NA1_T1", 1100, ago(20), tft.ParticipantV1DTO{
+				PUUID: "puuid-simi", Placement: 2, Level: 8,
+				Traits: []tft.TraitV1DTO{{Name: "Set10_KDA", TierCurrent: 2}, {Name: "Set10_EDM", TierCurrent: 0}},
+				Units:  []tft.UnitV1DTO{{CharacterID: "TFT10_Ahri"}},
+			}),
+			// Double Up and Hyper Roll
+			tftMatch("NA1_T2", 1160, ago(10), tft.ParticipantV1DTO{PUUID: "puuid-simi", Placement: 1, Level: 9}),
+			tftMatch("NA1_T3", 1130, ago(8), tft.ParticipantV1DTO{PUUID: "puuid-simi", Placement: 8, Level: 5}),
+			tftMatch("NA1_T4", 1100, ago(4), tft.ParticipantV1DTO{PUUID: "puuid-simi", Placement: 6, Level: 7}),
+		},
+	}
+}
+
+func newClient(t *testing.T, srv *riottest.Server, keys string) *simi.Client {
+	t.Helper()
+	t.Setenv("RIOT_TOKEN", keys)
+	// Setenv puts it back afterwards, Unsetenv alone wouldn't
+	t.Setenv("RIOT_TOKEN_FILE", "")
+	os.Unsetenv("RIOT_TOKEN_FILE")
+	client, err := simi.New(5*time.Second, simi.WithBaseURL(srv.BaseURL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestAccountsAndMatches(t *testing.T) {
+	srv := riottest.NewServer(scenario())
+	defer srv.Close()
+	client := newClient(t, srv, "test")
+
+	// Riot IDs are case insensitive
+	account, err := client.AccountByRiotID("SimiPangPang", "na1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.PUUID != "puuid-simi" || account.Name != "simipangpang" || account.Discrim != "NA1" {
+		t.Errorf("got account %v#%v (%v), want simipangpang#NA1 (puuid-simi)", account.Name, account.Discrim, account.PUUID)
+	}
+	if !account.Ranked() || account.Rank != "Gold II" || account.Wins != 30 || account.Losses != 20 || account.Points != 45 {
+		t.Errorf("got rank %v %vW %vL %v LP, want Gold II 30W 20L 45 LP", account.Rank, account.Wins, account.Losses, account.Points)
+	}
+
+	matches, err := client.MatchesSince(account, simi.QueueRanked, now.AddDate(0, 0, -7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, match := range matches {
+		ids = append(ids, match.ID)
+	}
+	// Not the old one, the ARAM game or the remake
+	if want := []string{"NA1_4", "NA1_3"}; !slices.Equal(ids, want) {
+		t.Fatalf("got matches %v, want %v", ids, want)
+	}
+	best := matches[0]
+	if best.Kills != 10 || best.Deaths != 2 || best.Assists != 8 || !best.Won || best.Champ != 103 {
+		t.Errorf("got %v/%v/%v (won %v) on %v, want 10/2/8 (won true) on 103", best.Kills, best.Deaths, best.Assists, best.Won, best.Champ)
+	}
+	if !best.Time.Equal(now.Add(-5*time.Hour)) || best.Keystone != 8112 || !slices.Equal(best.Items, []int32{3089}) || !slices.Equal(best.Spells, []int32{4, 14}) {
+		t.Errorf("got match details %+v", best)
+	}
+
+	champ, err := client.ChampionByID(103, simi.DefaultLanguage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if champ.Name != "Ahri" {
+		t.Errorf("got champion %v, want Ahri", champ.Name)
+	}
+}
+
+func TestUnrankedAccount(t *testing.T) {
+	srv := riottest.NewServer(scenario())
+	defer srv.Close()
+	client := newClient(t, srv, "test")
+
+	account, err := client.AccountByPUUID("puuid-newbie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Ranked() || account.Rank != "Unranked" {
+		t.Errorf("got rank %v, want Unranked", account.Rank)
+	}
+	if _, err := client.AccountByRiotID("nobody", "NA1"); err == nil {
+		t.Error("got an account for a player that doesn't exist")
+	}
+}
+
+func TestPUUIDByRiotID(t *testing.T) {
+	srv := riottest.NewServer(scenario())
+	defer srv.Close()
+	client := newClient(t, srv, "test")
+	// Nothing past Account-V1 should be needed
+	srv.FailOn("/lol/", 500)
+
+	puuid, err := client.PUUIDByRiotID("SimiPangPang", "na1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if puuid != "puuid-simi" {
+		t.Errorf("got puuid %v, want puuid-simi", puuid)
+	}
+	if _, err := client.PUUIDByRiotID("nobody", "NA1"); err == nil {
+		t.Error("got a puuid for a player that doesn't exist")
+	}
+}
+
+func TestTFT(t *testing.T) {
+	srv := riottest.NewServer(scenario())
+	defer srv.Close()
+	client := newClient(t, srv, "test")
+
+	account, err := client.AccountByPUUID("puuid-simi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Not the Double Up rating
+	rank, err := client.TFTRankFor(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rank.Ranked() || rank.Rank != "Silver III" || rank.Points != 10 || rank.Wins != 12 {
+		t.Errorf("got tft rank %+v, want Silver III with 10 LP", rank)
+	}
+
+	matches, err := client.TFTMatchesSince(account, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	placements := []int32{}
+	for _, match := range matches {
+		placements = append(placements, match.Placement)
+	}
+	// Only the ranked ones, newest first
+	if want := []int32{6, 2}; !slices.Equal(placements, want) {
+		t.Fatalf("got tft matches placing %v, want %v", placements, want)
+	}
+	if last := matches[1]; !slices.Equal(last.Traits, []string{"KDA"}) || !slices.Equal(last.Units, []string{"Ahri"}) {
+		t.Errorf("got traits %v and units %v, want [KDA] and [Ahri]", last.Traits, last.Units)
+	}
+
+	newbie, err := client.AccountByPUUID("puuid-newbie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rank, err = client.TFTRankFor(newbie)
+	if err != nil {
+		t.Fatalf("unranked player got an error: %v", err)
+	}
+	if rank.Ranked() || rank.Rank != "Unranked" || rank.RankURL != "" {
+		t.Errorf("got tft rank %+v, want Unranked", rank)
+	}
+}
+
+func TestDDragonCatalogs(t *testing.T) {
+	srv := riottest.NewServer(scenario())
+	defer srv.Close()
+	client := newClient(t, srv, "test")
+
+	item, err := client.Item(3089, simi.DefaultLanguage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Name != "Rabadon's Deathcap" {
+		t.Errorf("got item %v, want Rabadon's Deathcap", item.Name)
+	}
+	if url := client.IconURLForItem(item); url != "https://ddragon.leagueoflegends.com/cdn/14.5.1/img/item/3089.png" {
+		t.Errorf("got item icon %v", url)
+	}
+
+	perk, err := client.Rune(8112, simi.DefaultLanguage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perk.Name != "Electrocute" {
+		t.Errorf("got rune %v, want Electrocute", perk.Name)
+	}
+	// Not versioned
+	if url := client.IconURLForRune(perk); url != "https://ddragon.leagueoflegends.com/cdn/img/perk-images/Styles/Domination/Electrocute/Electrocute.png" {
+		t.Errorf("got rune icon %v", url)
+	}
+
+	// Looked up by key, not by the SummonerFlash style ID
+	spell, err := client.SummonerSpell(4, simi.DefaultLanguage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spell.Name != "Flash" {
+		t.Errorf("got summoner spell %v, want Flash", spell.Name)
+	}
+	if url := client.IconURLForSpell(spell); url != "https://ddragon.leagueoflegends.com/cdn/14.5.1/img/spell/SummonerFlash.png" {
+		t.Errorf("got summoner spell icon %v", url)
+	}
+
+	// Things that aren't in the catalogs
+	if _, err := client.Item(1, simi.DefaultLanguage); err == nil {
+		t.Error("got an item that doesn't exist")
+	}
+	if _, err := client.Rune(1, simi.DefaultLanguage); err == nil {
+		t.Error("got a rune that doesn't exist")
+	}
+	if _, err := client.SummonerSpell(14, simi.DefaultLanguage); err == nil {
+		t.Error("got a summoner spell that doesn't exist")
+	}
+
+	// Each catalog only gets fetched once per language
+	srv.Update(func(scenario *riottest.Scenario) {
+		scenario.Items = nil
+		scenario.Runes = nil
+		scenario.Spells = nil
+	})
+	if _, err := client.Item(3089, simi.DefaultLanguage); err != nil {
+		t.Errorf("item catalog got fetched again: %v", err)
+	}
+	if _, err := client.Rune(8112, simi.DefaultLanguage); err != nil {
+		t.Errorf("rune catalog got fetched again: %v", err)
+	}
+	if _, err := client.SummonerSpell(4, simi.DefaultLanguage); err != nil {
+		t.Errorf("summoner spell catalog got fetched again: %v", err)
+	}
+	// But another language is a different catalog
+	if _, err := client.Item(3089, "ko_KR"); err == nil {
+		t.Error("got an item from a catalog that was never fetched")
+	}
+}
+
+func TestFailingAPI(t *testing.T) {
+	srv := riottest.NewServer(scenario())
+	defer srv.Close()
+	client := newClient(t, srv, "test")
+
+	srv.Fail(500)
+	if _, err := client.AccountByPUUID("puuid-simi"); err == nil {
+		t.Fatal("got an account while the api was failing")
+	}
+	srv.Fail(0)
+	if _, err := client.AccountByPUUID("puuid-simi"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type rejection struct {
+	key    string
+	status int
+	left   int
+}
+
+func TestKeysRejected(t *testing.T) {
+	srv := riottest.NewServer(scenario())
+	defer srv.Close()
+	client := newClient(t, srv, "first-key,second-key")
+	rejected := make(chan rejection, 4)
+	client.OnKeyRejected(func(key string, status int, left int) {
+		rejected <- rejection{key, status, left}
+	})
+
+	if _, err := client.AccountByPUUID("puuid-simi"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both keys get tried before giving up
+	srv.Fail(401)
+	if _, err := client.AccountByPUUID("puuid-simi"); err == nil {
+		t.Fatal("got an account with every key rejected")
+	}
+	got := []rejection{}
+	for len(got) < 2 {
+		select {
+		case r := <-rejected:
+			got = append(got, r)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only got %v key rejections, want 2", len(got))
+		}
+	}
+	slices.SortFunc(got, func(one, two rejection) int { return two.left - one.left })
+	for i, r := range got {
+		if r.status != 401 || r.left != 1-i {
+			t.Errorf("got rejection %+v, want status 401 with %v left", r, 1-i)
+		}
+		if r.key == "first-key" || r.key == "second-key" {
+			t.Errorf("rejected key %v wasn't masked", r.key)
+		}
+	}
+
+	// A new key puts things back to normal
+	srv.Fail(0)
+	if err := client.SetKey("third-key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.AccountByPUUID("puuid-simi"); err != nil {
+		t.Fatalf("new key didn't work: %v", err)
+	}
+	select {
+	case r := <-rejected:
+		t.Errorf("got another rejection %+v after the key was replaced", r)
+	default:
+	}
+}
+
+// A 403 only means a bad key if the status endpoint, which every key can use, says so too
+func TestForbidden(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(srv *riottest.Server, status int)
+		// Whether the key should get revoked
+		revoked bool
+	}{
+		{"expired key", (*riottest.Server).Fail, true},
+		{"endpoint off limits", func(srv *riottest.Server, status int) { srv.FailOn("/riot/account/", status) }, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := riottest.NewServer(scenario())
+			defer srv.Close()
+			client := newClient(t, srv, "test")
+			rejected := make(chan rejection, 1)
+			client.OnKeyRejected(func(key string, status int, left int) {
+				rejected <- rejection{key, status, left}
+			})
+
+			test.fail(srv, 403)
+			if _, err := client.AccountByPUUID("puuid-simi"); err == nil {
+				t.Fatal("got an account while the api was failing")
+			}
+			if test.revoked {
+				select {
+				case r := <-rejected:
+					if r.status != 403 || r.left != 0 {
+						t.Errorf("got rejection %+v, want status 403 with none left", r)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("expired key wasn't rejected")
+				}
+			} else {
+				select {
+				case r := <-rejected:
+					t.Errorf("key was rejected over a %v", r.status)
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+
+			// Either way it gets tried again once things are back to normal
+			test.fail(srv, 0)
+			if _, err := client.AccountByPUUID("puuid-simi"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,375 @@
+// Decides which Riot requests go out first. Everything shares one rate limit, so somebody running a
+// command shouldn't have to wait behind a pile of background polling.
+
+package riot
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Priority int
+
+const (
+	// Someone is waiting on the result, like a slash command
+	PriorityInteractive Priority = iota
+	// Update ticks, recaps and anything else nobody's staring at
+	PriorityBackground
+)
+
+type priorityKey struct{}
+
+type requestPriority struct {
+	priority Priority
+	// Requests from the same guild take turns with every other guild
+	guild string
+}
+
+// A priority that can go up after requests were sent with it. Lookups that more than one caller
+// is waiting on use this, so a slash command that joins an update's lookup doesn't wait behind it.
+type SharedPriority struct {
+	mu sync.Mutex
+	p  requestPriority
+	// Closed once it's raised, so requests that are already waiting move up too
+	raised chan struct{}
+}
+
+func NewSharedPriority(priority Priority, guild string) *SharedPriority {
+	return &SharedPriority{
+		p:      requestPriority{priority: priority, guild: guild},
+		raised: make(chan struct{}),
+	}
+}
+
+// Makes it interactive, if it isn't already
+func (s *SharedPriority) Raise() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.p.priority == PriorityInteractive {
+		return
+	}
+	s.p.priority = PriorityInteractive
+	close(s.raised)
+}
+
+func (s *SharedPriority) Priority() Priority {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.p.priority
+}
+
+// The channel is nil if there's nothing left to raise it to
+func (s *SharedPriority) get() (requestPriority, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.p.priority == PriorityInteractive {
+		return s.p, nil
+	}
+	return s.p, s.raised
+}
+
+func withPriority(ctx context.Context, priority *SharedPriority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// Requests without a priority are treated as interactive
+func priorityFrom(ctx context.Context) (requestPriority, <-chan struct{}) {
+	if p, ok := ctx.Value(priorityKey{}).(*SharedPriority); ok {
+		return p.get()
+	}
+	return requestPriority{priority: PriorityInteractive}, nil
+}
+
+const (
+	// How many requests can be going at once
+	schedulerConcurrency = 4
+	// Background requests wait once less than this much of any rate limit window is left
+	backgroundReserve = 0.2
+)
+
+// One window of the app rate limit, like 100 requests every 2 minutes
+type rateWindow struct {
+	length time.Duration
+	limit  int
+	count  int
+	reset  time.Time
+}
+
+type waiter struct {
+	ready chan struct{}
+}
+
+// Waiters for one priority, grouped by guild so they can be served round-robin
+type guildQueues struct {
+	order  []string
+	queues map[string][]*waiter
+}
+
+func (q *guildQueues) push(guild string, w *waiter) {
+	if q.queues == nil {
+		q.queues = make(map[string][]*waiter)
+	}
+	if len(q.queues[guild]) == 0 {
+		q.order = append(q.order, guild)
+	}
+	q.queues[guild] = append(q.queues[guild], w)
+}
+
+func (q *guildQueues) pop() *waiter {
+	if len(q.order) == 0 {
+		return nil
+	}
+	guild := q.order[0]
+	q.order = q.order[1:]
+	w := q.queues[guild][0]
+	q.queues[guild] = q.queues[guild][1:]
+	if len(q.queues[guild]) > 0 {
+		// Back of the line
+		q.order = append(q.order, guild)
+	} else {
+		delete(q.queues, guild)
+	}
+	return w
+}
+
+// Returns whether the waiter was still there
+func (q *guildQueues) remove(guild string, w *waiter) bool {
+	queue := q.queues[guild]
+	for i, other := range queue {
+		if other != w {
+			continue
+		}
+		q.queues[guild] = append(queue[:i], queue[i+1:]...)
+		if len(q.queues[guild]) == 0 {
+			delete(q.queues, guild)
+			for j, g := range q.order {
+				if g == guild {
+					q.order = append(q.order[:j], q.order[j+1:]...)
+					break
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Rate limits for one key, from the X-App-Rate-Limit headers
+type rateLimits struct {
+	// Keyed by window length in seconds
+	windows map[int]*rateWindow
+	// From Retry-After when Riot says we went over anyway
+	blockedUntil time.Time
+}
+
+type scheduler struct {
+	mu       sync.Mutex
+	queues   map[Priority]*guildQueues
+	inflight int
+	// Where the rate limits come from
+	keys *keyPool
+	// Set while waiting for a window to reset
+	timer *time.Timer
+	next  http.RoundTripper
+}
+
+func newScheduler(keys *keyPool, next http.RoundTripper) *scheduler {
+	return &scheduler{
+		queues: map[Priority]*guildQueues{
+			PriorityInteractive: {},
+			PriorityBackground:  {},
+		},
+		keys: keys,
+		next: next,
+	}
+}
+
+func (s *scheduler) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Data Dragon doesn't count towards the rate limit
+	if endpoint, _ := endpointFor(req.URL.Path); endpoint == EndpointDDragon {
+		return s.next.RoundTrip(req)
+	}
+
+	p, raised := priorityFrom(req.Context())
+	w := &waiter{ready: make(chan struct{})}
+	s.mu.Lock()
+	s.queues[p.priority].push(p.guild, w)
+	s.dispatch()
+	s.mu.Unlock()
+
+	for waiting := true; waiting; {
+		select {
+		case <-w.ready:
+			waiting = false
+		case <-raised:
+			raised = nil
+			s.mu.Lock()
+			// If it's not there, it already got picked
+			if s.queues[p.priority].remove(p.guild, w) {
+				p.priority = PriorityInteractive
+				s.queues[p.priority].push(p.guild, w)
+				s.dispatch()
+			}
+			s.mu.Unlock()
+		case <-req.Context().Done():
+			s.mu.Lock()
+			removed := s.queues[p.priority].remove(p.guild, w)
+			s.mu.Unlock()
+			if removed {
+				return nil, req.Context().Err()
+			}
+			// It got picked right as it was cancelled, so give the slot back
+			<-w.ready
+			s.release()
+			return nil, req.Context().Err()
+		}
+	}
+
+	resp, err := s.next.RoundTrip(req)
+	s.release()
+	return resp, err
+}
+
+// The key pool already saw the response's rate limit headers by the time this is called
+func (s *scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inflight--
+	s.dispatch()
+}
+
+// Has to be called with the lock held
+func (s *scheduler) dispatch() {
+	for s.inflight < schedulerConcurrency {
+		w := (*waiter)(nil)
+		if s.keys.hasBudget(0) {
+			w = s.queues[PriorityInteractive].pop()
+		}
+		if w == nil && s.keys.hasBudget(backgroundReserve) {
+			w = s.queues[PriorityBackground].pop()
+		}
+		if w == nil {
+			break
+		}
+		s.inflight++
+		close(w.ready)
+	}
+	s.wakeAtReset()
+}
+
+// Whether every window has more than reserve of its limit left
+func (l *rateLimits) hasBudget(reserve float64) bool {
+	now := time.Now()
+	if now.Before(l.blockedUntil) {
+		return false
+	}
+	for _, window := range l.windows {
+		if now.After(window.reset) {
+			window.count = 0
+			window.reset = now.Add(window.length)
+		}
+		if float64(window.count) >= float64(window.limit)*(1-reserve) {
+			return false
+		}
+	}
+	return true
+}
+
+// Counted locally too, since the headers only show up once the response comes back
+func (l *rateLimits) count() {
+	for _, window := range l.windows {
+		window.count++
+	}
+}
+
+// How much of the most used window is used up, from 0 to 1
+func (l *rateLimits) usage() float64 {
+	usage := 0.0
+	for _, window := range l.windows {
+		if window.limit > 0 && time.Now().Before(window.reset) {
+			usage = max(usage, float64(window.count)/float64(window.limit))
+		}
+	}
+	return usage
+}
+
+// If anything is stuck waiting on the rate limit, try again once the soonest window resets
+func (s *scheduler) wakeAtReset() {
+	waiting := len(s.queues[PriorityInteractive].order) > 0 || len(s.queues[PriorityBackground].order) > 0
+	if !waiting || s.timer != nil || s.inflight > 0 {
+		// Anything in flight will dispatch when it's done
+		return
+	}
+	now := time.Now()
+	soonest := time.Time{}
+	for _, at := range s.keys.resets() {
+		if at.After(now) && (soonest.IsZero() || at.Before(soonest)) {
+			soonest = at
+		}
+	}
+	if soonest.IsZero() {
+		return
+	}
+	s.timer = time.AfterFunc(time.Until(soonest), func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.timer = nil
+		s.dispatch()
+	})
+}
+
+func (l *rateLimits) resets() []time.Time {
+	resets := []time.Time{l.blockedUntil}
+	for _, window := range l.windows {
+		resets = append(resets, window.reset)
+	}
+	return resets
+}
+
+// Headers look like "20:1,100:120" (limit:seconds) and "3:1,17:120" (count:seconds)
+func parseRateHeader(header string) map[int]int {
+	values := map[int]int{}
+	for _, pair := range strings.Split(header, ",") {
+		value, window, ok := strings.Cut(pair, ":")
+		if !ok {
+			continue
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		w, err := strconv.Atoi(strings.TrimSpace(window))
+		if err != nil {
+			continue
+		}
+		values[w] = v
+	}
+	return values
+}
+
+func (l *rateLimits) update(header http.Header) {
+	limits := parseRateHeader(header.Get("X-App-Rate-Limit"))
+	counts := parseRateHeader(header.Get("X-App-Rate-Limit-Count"))
+	now := time.Now()
+	for seconds, limit := range limits {
+		if l.windows == nil {
+			l.windows = make(map[int]*rateWindow)
+		}
+		window, ok := l.windows[seconds]
+		if !ok {
+			length := time.Duration(seconds) * time.Second
+			window = &rateWindow{length: length, reset: now.Add(length)}
+			l.windows[seconds] = window
+		}
+		window.limit = limit
+		// Riot's count wins if it's higher, since other bots might be using the same key
+		window.count = max(window.count, counts[seconds])
+	}
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+		l.blockedUntil = now.Add(time.Duration(seconds) * time.Second)
+	}
+}
@@ -0,0 +1,295 @@
+package riot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Holds every request until it's released, and says which one came in
+type gatedTransport struct {
+	arrived chan string
+	release chan struct{}
+}
+
+func newGatedTransport() *gatedTransport {
+	return &gatedTransport{arrived: make(chan string, 16), release: make(chan struct{})}
+}
+
+func (g *gatedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	g.arrived <- strings.TrimPrefix(req.URL.Path, "/lol/summoner/v4/summoners/by-puuid/")
+	<-g.release
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+// Sends the request in the background, named so the transport can tell them apart
+func sendScheduled(t *testing.T, s *scheduler, name string, priority *SharedPriority) {
+	t.Helper()
+	ctx := withPriority(context.Background(), priority)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://na1.api.riotgames.com/lol/summoner/v4/summoners/by-puuid/"+name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		resp, err := s.RoundTrip(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+}
+
+// Waits until this many requests are queued up in the scheduler
+func waitQueued(t *testing.T, s *scheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		queued := 0
+		for _, queues := range s.queues {
+			for _, queue := range queues.queues {
+				queued += len(queue)
+			}
+		}
+		s.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("never got %v requests queued", n)
+}
+
+func nextArrival(t *testing.T, g *gatedTransport, within time.Duration) string {
+	t.Helper()
+	select {
+	case name := <-g.arrived:
+		return name
+	case <-time.After(within):
+		t.Fatal("no request went out")
+		return ""
+	}
+}
+
+func expectNoArrival(t *testing.T, g *gatedTransport, within time.Duration) {
+	t.Helper()
+	select {
+	case name := <-g.arrived:
+		t.Fatalf("request %v went out, want it to wait", name)
+	case <-time.After(within):
+	}
+}
+
+// Takes up every slot, so whatever gets queued after this has to wait its turn
+func fillSlots(t *testing.T, s *scheduler, g *gatedTransport) {
+	t.Helper()
+	for i := 0; i < schedulerConcurrency; i++ {
+		sendScheduled(t, s, "blocker", NewSharedPriority(PriorityInteractive, "blocker"))
+		nextArrival(t, g, time.Second)
+	}
+}
+
+// Lets the queued requests out one at a time and returns the order they went out in
+func drain(t *testing.T, g *gatedTransport, n int) []string {
+	t.Helper()
+	order := []string{}
+	for i := 0; i < n; i++ {
+		g.release <- struct{}{}
+		order = append(order, nextArrival(t, g, time.Second))
+	}
+	return order
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	type request struct {
+		name     string
+		priority Priority
+		guild    string
+	}
+	tests := []struct {
+		name     string
+		requests []request
+		want     []string
+	}{
+		{
+			"interactive before background",
+			[]request{
+				{"update-1", PriorityBackground, "guild-1"},
+				{"update-2", PriorityBackground, "guild-2"},
+				{"command-1", PriorityInteractive, "guild-1"},
+				{"command-2", PriorityInteractive, "guild-3"},
+			},
+			[]string{"command-1", "command-2", "update-1", "update-2"},
+		},
+		{
+			"guilds take turns",
+			[]request{
+				{"busy-1", PriorityInteractive, "busy"},
+				{"busy-2", PriorityInteractive, "busy"},
+				{"busy-3", PriorityInteractive, "busy"},
+				{"quiet", PriorityInteractive, "quiet"},
+				{"other", PriorityInteractive, "other"},
+			},
+			[]string{"busy-1", "quiet", "other", "busy-2", "busy-3"},
+		},
+		{
+			"guilds take turns in the background too",
+			[]request{
+				{"busy-1", PriorityBackground, "busy"},
+				{"busy-2", PriorityBackground, "busy"},
+				{"quiet", PriorityBackground, "quiet"},
+			},
+			[]string{"busy-1", "quiet", "busy-2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := newGatedTransport()
+			s := newScheduler(newKeyPool([]string{"test"}), g)
+			fillSlots(t, s, g)
+			for i, req := range test.requests {
+				sendScheduled(t, s, req.name, NewSharedPriority(req.priority, req.guild))
+				// So they're queued in order
+				waitQueued(t, s, i+1)
+			}
+
+			got := drain(t, g, len(test.requests))
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("requests went out in order %v, want %v", got, test.want)
+			}
+			close(g.release)
+		})
+	}
+}
+
+func TestSchedulerRaiseWhileWaiting(t *testing.T) {
+	g := newGatedTransport()
+	s := newScheduler(newKeyPool([]string{"test"}), g)
+	fillSlots(t, s, g)
+
+	sendScheduled(t, s, "update", NewSharedPriority(PriorityBackground, "guild-1"))
+	waitQueued(t, s, 1)
+	shared := NewSharedPriority(PriorityBackground, "guild-2")
+	sendScheduled(t, s, "joined", shared)
+	waitQueued(t, s, 2)
+	// Someone interactive started waiting on it
+	shared.Raise()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		moved := len(s.queues[PriorityInteractive].order) == 1
+		s.mu.Unlock()
+		if moved {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	got := drain(t, g, 2)
+	if want := []string{"joined", "update"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("requests went out in order %v, want %v", got, want)
+	}
+	close(g.release)
+}
+
+func TestSchedulerBackgroundReserve(t *testing.T) {
+	g := newGatedTransport()
+	keys := newKeyPool([]string{"test"})
+	// Past the point where background requests have to wait, but interactive ones still fit.
+	// The window resets soon after, which should let the background request through.
+	keys.keys[0].limits.windows = map[int]*rateWindow{
+		1: {length: time.Second, reset: time.Now().Add(200 * time.Millisecond), limit: 10, count: 9},
+	}
+	s := newScheduler(keys, g)
+	defer close(g.release)
+
+	start := time.Now()
+	sendScheduled(t, s, "update", NewSharedPriority(PriorityBackground, "guild"))
+	expectNoArrival(t, g, 50*time.Millisecond)
+
+	sendScheduled(t, s, "command", NewSharedPriority(PriorityInteractive, "guild"))
+	if name := nextArrival(t, g, time.Second); name != "command" {
+		t.Fatalf("%v went out first, want the command", name)
+	}
+	g.release <- struct{}{}
+
+	// Nothing in flight anymore, so it's up to the timer
+	if name := nextArrival(t, g, time.Second); name != "update" {
+		t.Fatalf("got %v, want the update once the window reset", name)
+	}
+	if waited := time.Since(start); waited < 150*time.Millisecond {
+		t.Errorf("update went out after %v, before the window reset", waited)
+	}
+}
+
+func TestSchedulerWakesAfterRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		priority Priority
+	}{
+		{"interactive", PriorityInteractive},
+		{"background", PriorityBackground},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := newGatedTransport()
+			keys := newKeyPool([]string{"test"})
+			keys.keys[0].limits.blockedUntil = time.Now().Add(100 * time.Millisecond)
+			s := newScheduler(keys, g)
+			defer close(g.release)
+
+			start := time.Now()
+			sendScheduled(t, s, "waiting", NewSharedPriority(test.priority, "guild"))
+			expectNoArrival(t, g, 50*time.Millisecond)
+			// Nothing else comes along to dispatch it, so this is all on wakeAtReset
+			if name := nextArrival(t, g, time.Second); name != "waiting" {
+				t.Fatalf("got %v, want the waiting request", name)
+			}
+			if waited := time.Since(start); waited < 90*time.Millisecond {
+				t.Errorf("request went out after %v, before Retry-After was up", waited)
+			}
+		})
+	}
+}
+
+func TestSchedulerCancelWhileWaiting(t *testing.T) {
+	g := newGatedTransport()
+	s := newScheduler(newKeyPool([]string{"test"}), g)
+	fillSlots(t, s, g)
+	defer close(g.release)
+
+	ctx, cancel := context.WithCancel(withPriority(context.Background(), NewSharedPriority(PriorityInteractive, "guild")))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://na1.api.riotgames.com/lol/summoner/v4/summoners/by-puuid/cancelled", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		_, err := s.RoundTrip(req)
+		errs <- err
+	}()
+	waitQueued(t, s, 1)
+	cancel()
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("cancelled request went out anyway")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelled request is still waiting")
+	}
+	waitQueued(t, s, 0)
+
+	// Its spot doesn't go to waste either
+	sendScheduled(t, s, "after", NewSharedPriority(PriorityInteractive, "guild"))
+	if got := drain(t, g, 1); got[0] != "after" {
+		t.Errorf("got %v, want the request after the cancelled one", got[0])
+	}
+}
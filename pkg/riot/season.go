@@ -0,0 +1,127 @@
+// Ranked season / split calendar.
+
+package riot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+type Split struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (s *Split) Contains(t time.Time) bool {
+	return !t.Before(s.Start) && t.Before(s.End)
+}
+
+type Calendar struct {
+	// Sorted by start time
+	splits []Split
+}
+
+// Path to a JSON file with a list of splits that overrides the defaults
+const calendarEnv = "SEASON_CALENDAR"
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+}
+
+// Riot announces these every year so they're only approximate past what's been announced.
+// If they end up being wrong, override them with a calendar file instead of editing these.
+var defaultSplits = []Split{
+	{Name: "2024 Split 1", Start: date(2024, time.January, 10), End: date(2024, time.May, 15)},
+	{Name: "2024 Split 2", Start: date(2024, time.May, 15), End: date(2024, time.September, 25)},
+	{Name: "2024 Split 3", Start: date(2024, time.September, 25), End: date(2025, time.January, 9)},
+	{Name: "2025 Season 1", Start: date(2025, time.January, 9), End: date(2025, time.April, 30)},
+	{Name: "2025 Season 2", Start: date(2025, time.April, 30), End: date(2025, time.August, 27)},
+	{Name: "2025 Season 3", Start: date(2025, time.August, 27), End: date(2026, time.January, 8)},
+	{Name: "2026 Split 1", Start: date(2026, time.January, 8), End: date(2026, time.April, 29)},
+	{Name: "2026 Split 2", Start: date(2026, time.April, 29), End: date(2026, time.August, 26)},
+	{Name: "2026 Split 3", Start: date(2026, time.August, 26), End: date(2027, time.January, 7)},
+}
+
+func NewCalendar(splits []Split) (*Calendar, error) {
+	sorted := slices.Clone(splits)
+	slices.SortFunc(sorted, func(one, two Split) int {
+		return one.Start.Compare(two.Start)
+	})
+	for i, split := range sorted {
+		if !split.Start.Before(split.End) {
+			return nil, fmt.Errorf("split %v ends before it starts", split.Name)
+		}
+		if i > 0 && split.Start.Before(sorted[i-1].End) {
+			return nil, fmt.Errorf("split %v overlaps with split %v", split.Name, sorted[i-1].Name)
+		}
+	}
+	return &Calendar{splits: sorted}, nil
+}
+
+func DefaultCalendar() *Calendar {
+	// The defaults are known good so this can't fail
+	calendar, _ := NewCalendar(defaultSplits)
+	return calendar
+}
+
+// Loads the calendar from the file in the environment if it's set, otherwise the defaults
+func LoadCalendar() (*Calendar, error) {
+	name, ok := os.LookupEnv(calendarEnv)
+	if !ok || name == "" {
+		return DefaultCalendar(), nil
+	}
+	contents, err := os.ReadFile(name)
+	if err != nil {
+		// Even if it doesn't exist, since a typo in the path shouldn't quietly send recaps on the wrong dates
+		return nil, fmt.Errorf("couldn't read calendar file %v: %v", name, err)
+	}
+	splits := []Split{}
+	if err := json.Unmarshal(contents, &splits); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal calendar file %v: %v", name, err)
+	}
+	return NewCalendar(splits)
+}
+
+// Returns nil if t is in between splits (or past the end of the calendar)
+func (c *Calendar) SplitAt(t time.Time) *Split {
+	for i := range c.splits {
+		if c.splits[i].Contains(t) {
+			split := c.splits[i]
+			return &split
+		}
+	}
+	return nil
+}
+
+func (c *Calendar) Current() *Split {
+	return c.SplitAt(time.Now())
+}
+
+// The first split that ends after t, used to schedule end of split recaps
+func (c *Calendar) NextEnd(t time.Time) *Split {
+	for i := range c.splits {
+		if c.splits[i].End.After(t) {
+			split := c.splits[i]
+			return &split
+		}
+	}
+	return nil
+}
+
+// Whether ranks got reset at some point between from and to.
+// LP from different splits isn't comparable since everyone gets placed again.
+func (c *Calendar) CrossesReset(from, to time.Time) bool {
+	if to.Before(from) {
+		from, to = to, from
+	}
+	for _, split := range c.splits {
+		if from.Before(split.Start) && !to.Before(split.Start) {
+			return true
+		}
+	}
+	return false
+}
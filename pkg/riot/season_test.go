@@ -0,0 +1,205 @@
+package riot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewCalendar(t *testing.T) {
+	one := Split{Name: "One", Start: date(2024, time.January, 10), End: date(2024, time.May, 15)}
+	two := Split{Name: "Two", Start: date(2024, time.May, 15), End: date(2024, time.September, 25)}
+	tests := []struct {
+		name   string
+		splits []Split
+		// Empty if it should work
+		err string
+	}{
+		{"empty", nil, ""},
+		{"back to back", []Split{one, two}, ""},
+		{"out of order", []Split{two, one}, ""},
+		{"gap in between", []Split{one, {Name: "Later", Start: date(2025, time.January, 1), End: date(2025, time.May, 1)}}, ""},
+		{"overlapping", []Split{one, {Name: "Early", Start: date(2024, time.May, 1), End: date(2024, time.June, 1)}}, "overlaps"},
+		{"inside another", []Split{one, {Name: "Inside", Start: date(2024, time.February, 1), End: date(2024, time.March, 1)}}, "overlaps"},
+		{"same start", []Split{one, {Name: "Same", Start: one.Start, End: date(2024, time.February, 1)}}, "overlaps"},
+		{"ends before it starts", []Split{{Name: "Backwards", Start: one.End, End: one.Start}}, "ends before it starts"},
+		{"no length", []Split{{Name: "Empty", Start: one.Start, End: one.Start}}, "ends before it starts"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calendar, err := NewCalendar(test.splits)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("got error %v, want none", err)
+				}
+				for i := 1; i < len(calendar.splits); i++ {
+					if calendar.splits[i].Start.Before(calendar.splits[i-1].Start) {
+						t.Errorf("splits aren't sorted: %v", calendar.splits)
+					}
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want one saying %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestDefaultCalendar(t *testing.T) {
+	if _, err := NewCalendar(defaultSplits); err != nil {
+		t.Fatalf("default splits don't make a valid calendar: %v", err)
+	}
+}
+
+func TestCalendarSplits(t *testing.T) {
+	calendar, err := NewCalendar([]Split{
+		{Name: "One", Start: date(2024, time.January, 10), End: date(2024, time.May, 15)},
+		{Name: "Two", Start: date(2024, time.May, 15), End: date(2024, time.September, 25)},
+		// Off season in between
+		{Name: "Three", Start: date(2024, time.October, 1), End: date(2025, time.January, 9)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	boundary := date(2024, time.May, 15)
+	tests := []struct {
+		name string
+		at   time.Time
+		// Empty for no split
+		splitAt string
+		nextEnd string
+	}{
+		{"before the calendar", date(2023, time.December, 1), "", "One"},
+		{"first day", date(2024, time.January, 10), "One", "One"},
+		{"middle", date(2024, time.March, 1), "One", "One"},
+		{"right before the boundary", boundary.Add(-time.Second), "One", "One"},
+		// A split's end is the next one's start, and belongs to the next one
+		{"on the boundary", boundary, "Two", "Two"},
+		{"off season", date(2024, time.September, 28), "", "Three"},
+		{"last split", date(2024, time.December, 1), "Three", "Three"},
+		{"after the calendar", date(2025, time.February, 1), "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if split := calendar.SplitAt(test.at); splitName(split) != test.splitAt {
+				t.Errorf("SplitAt got %q, want %q", splitName(split), test.splitAt)
+			}
+			if split := calendar.NextEnd(test.at); splitName(split) != test.nextEnd {
+				t.Errorf("NextEnd got %q, want %q", splitName(split), test.nextEnd)
+			}
+		})
+	}
+}
+
+func splitName(split *Split) string {
+	if split == nil {
+		return ""
+	}
+	return split.Name
+}
+
+func TestCalendarCurrent(t *testing.T) {
+	now := time.Now()
+	calendar, err := NewCalendar([]Split{
+		{Name: "Last", Start: now.AddDate(0, -6, 0), End: now.AddDate(0, 0, -1)},
+		{Name: "This", Start: now.AddDate(0, 0, -1), End: now.AddDate(0, 0, 1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current := calendar.Current(); splitName(current) != "This" {
+		t.Errorf("got current split %q, want This", splitName(current))
+	}
+
+	over, err := NewCalendar([]Split{{Name: "Over", Start: now.AddDate(-1, 0, 0), End: now.AddDate(0, -1, 0)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current := over.Current(); current != nil {
+		t.Errorf("got current split %v after the calendar ended", current.Name)
+	}
+}
+
+func TestCrossesReset(t *testing.T) {
+	calendar, err := NewCalendar([]Split{
+		{Name: "One", Start: date(2024, time.January, 10), End: date(2024, time.May, 15)},
+		{Name: "Two", Start: date(2024, time.May, 15), End: date(2024, time.September, 25)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	boundary := date(2024, time.May, 15)
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     bool
+	}{
+		{"same split", date(2024, time.February, 1), date(2024, time.March, 1), false},
+		{"across the boundary", date(2024, time.May, 1), date(2024, time.June, 1), true},
+		{"backwards across the boundary", date(2024, time.June, 1), date(2024, time.May, 1), true},
+		{"ending on the boundary", boundary.Add(-time.Hour), boundary, true},
+		{"starting on the boundary", boundary, boundary.Add(time.Hour), false},
+		{"ending right before the boundary", boundary.Add(-time.Hour), boundary.Add(-time.Second), false},
+		{"into the first split", date(2023, time.December, 1), date(2024, time.February, 1), true},
+		{"past the last split", date(2024, time.October, 1), date(2024, time.December, 1), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := calendar.CrossesReset(test.from, test.to); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadCalendar(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tests := []struct {
+		name string
+		// Empty leaves the variable unset
+		path string
+		// How many splits it should load, or -1 if it should fail
+		splits int
+	}{
+		{"unset", "", len(defaultSplits)},
+		{"valid", write("valid.json", `[{"name": "Only", "start": "2024-01-10T12:00:00Z", "end": "2024-05-15T12:00:00Z"}]`), 1},
+		{"missing", filepath.Join(dir, "missing.json"), -1},
+		{"malformed", write("malformed.json", `[{"name": "Only", "start": "not a date"`), -1},
+		{"not a list", write("object.json", `{"name": "Only"}`), -1},
+		{"overlapping", write("overlapping.json", `[
+			{"name": "One", "start": "2024-01-10T12:00:00Z", "end": "2024-05-15T12:00:00Z"},
+			{"name": "Two", "start": "2024-05-01T12:00:00Z", "end": "2024-09-25T12:00:00Z"}
+		]`), -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(calendarEnv, test.path)
+			if test.path == "" {
+				os.Unsetenv(calendarEnv)
+			}
+			calendar, err := LoadCalendar()
+			if test.splits < 0 {
+				if err == nil {
+					t.Fatal("got a calendar, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(calendar.splits) != test.splits {
+				t.Errorf("got %v splits, want %v", len(calendar.splits), test.splits)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+// Teamfight Tactics stats. These share the Account with League since it's the same Riot account.
+
+package riot
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/Kyagara/equinox/clients/tft"
+)
+
+type TFTRank struct {
+	Rank    string
+	RankURL string
+	Tier    string
+	Wins    int32
+	Losses  int32
+	Points  int32
+}
+
+// Same as Account, unranked players have an empty tier and no rank emblem
+func (r *TFTRank) Ranked() bool {
+	return r.Tier != ""
+}
+
+// Queue ID from https://static.developer.riotgames.com/docs/tft/queues.json.
+// Double Up and Hyper Roll have their own ratings, so only ranked games go in the stats next to the rank.
+const tftRankedQueueID = 1100
+
+type TFTMatch struct {
+	Placement int32
+	Level     int32
+	// Only traits that were actually active
+	Traits []string
+	Units  []string
+	Time   time.Time
+}
+
+// Riot prefixes everything with the set, like TFT10_Ahri or Set10_KDA
+var tftSetPrefix = regexp.MustCompile(`^(TFT|Set)\d+_`)
+
+func tftDisplayName(id string) string {
+	return tftSetPrefix.ReplaceAllString(id, "")
+}
+
+func (r *Client) TFTRankFor(account *Account) (*TFTRank, error) {
+	ctx, cancel := r.newContext()
+	defer cancel()
+	leagues, err := r.client.TFT.LeagueV1.SummonerEntries(ctx, r.tftPlatform, account.SummonerID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't lookup tft leagues for summoner by id %v: %v", account.SummonerID, err)
+	}
+	for _, league := range leagues {
+		// There's also Hyper Roll and Double Up but those aren't really ranked
+		if league.QueueType != tft.RANKED_TFT {
+			continue
+		}
+		rank, rankURL := rankStrings(string(league.Tier), string(league.Rank))
+		return &TFTRank{
+			Rank:    rank,
+			RankURL: rankURL,
+			Tier:    string(league.Tier),
+			Wins:    league.Wins,
+			Losses:  league.Losses,
+			Points:  league.LeaguePoints,
+		}, nil
+	}
+	return &TFTRank{Rank: unranked}, nil
+}
+
+func (r *Client) TFTMatchesSince(account *Account, since time.Time) ([]*TFTMatch, error) {
+	ctx, cancel := r.newContext()
+	defer cancel()
+	// No end time for the same reason as MatchesSince
+	ids, err := r.client.TFT.MatchV1.ListByPUUID(ctx, r.region, account.PUUID, 0, -1, since.Unix(), 100)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get tft match history for %v: %v", account.Name, err)
+	}
+
+	matches := []*TFTMatch{}
+	for _, id := range ids {
+		info, err := r.client.TFT.MatchV1.ByID(ctx, r.region, id)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up tft match id %v: %v", id, err)
+		}
+		// The match list can't be filtered by queue like League's can
+		if info.Info.QueueID != tftRankedQueueID {
+			continue
+		}
+		idx := slices.IndexFunc(info.Info.Participants, func(player tft.ParticipantV1DTO) bool {
+			return player.PUUID == account.PUUID
+		})
+		if idx == -1 {
+			return nil, fmt.Errorf("couldn't find player %v in tft match %v", account.Name, id)
+		}
+		player := info.Info.Participants[idx]
+
+		traits := []string{}
+		for _, trait := range player.Traits {
+			if trait.TierCurrent > 0 {
+				traits = append(traits, tftDisplayName(trait.Name))
+			}
+		}
+		units := []string{}
+		for _, unit := range player.Units {
+			units = append(units, tftDisplayName(unit.CharacterID))
+		}
+
+		matches = append(matches, &TFTMatch{
+			Placement: player.Placement,
+			Level:     player.Level,
+			Traits:    traits,
+			Units:     units,
+			// Also in ms like League
+			Time: time.Unix(info.Info.GameDatetime/1000, 0),
+		})
+	}
+	return matches, nil
+}
+
+// Same contract as CompareMatches
+func CompareTFTMatches(one, two *TFTMatch) int {
+	// Lower placement is better
+	if one.Placement != two.Placement {
+		return cmp.Compare(two.Placement, one.Placement)
+	}
+	return cmp.Compare(one.Level, two.Level)
+}
+
+func AveragePlacement(matches []*TFTMatch) float64 {
+	if len(matches) == 0 {
+		return 0
+	}
+	total := int32(0)
+	for _, match := range matches {
+		total += match.Placement
+	}
+	return float64(total) / float64(len(matches))
+}
+
+// The n names that show up the most, most common first
+func mostCommon(names []string, n int) []string {
+	counts := map[string]int{}
+	for _, name := range names {
+		counts[name]++
+	}
+	unique := []string{}
+	for name := range counts {
+		unique = append(unique, name)
+	}
+	slices.SortFunc(unique, func(one, two string) int {
+		if counts[one] != counts[two] {
+			return cmp.Compare(counts[two], counts[one])
+		}
+		// Keep it deterministic
+		return cmp.Compare(one, two)
+	})
+	if len(unique) > n {
+		unique = unique[:n]
+	}
+	return unique
+}
+
+func TopTraits(matches []*TFTMatch, n int) []string {
+	traits := []string{}
+	for _, match := range matches {
+		traits = append(traits, match.Traits...)
+	}
+	return mostCommon(traits, n)
+}
+
+func TopUnits(matches []*TFTMatch, n int) []string {
+	units := []string{}
+	for _, match := range matches {
+		units = append(units, match.Units...)
+	}
+	return mostCommon(units, n)
+}
@@ -0,0 +1,152 @@
+// HTTP transports that record Riot responses to fixture files and replay them later,
+// so development doesn't need a live key.
+
+package riot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Mode string
+
+const (
+	ModeLive   Mode = "live"
+	ModeRecord Mode = "record"
+	ModeReplay Mode = "replay"
+)
+
+const DefaultFixtureDir = "testdata/riot"
+
+func ParseMode(mode string) (Mode, error) {
+	switch Mode(mode) {
+	case "", ModeLive:
+		return ModeLive, nil
+	case ModeRecord, ModeReplay:
+		return Mode(mode), nil
+	default:
+		return "", fmt.Errorf("riot mode not recognized: %v", mode)
+	}
+}
+
+// Stuff that gets JSON'ed
+type fixture struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+// Time windows change every run, so they're left out of the key or nothing would ever replay
+var volatileParams = []string{"startTime", "endTime"}
+
+func fixtureKey(req *http.Request) string {
+	u := *req.URL
+	query := u.Query()
+	for _, param := range volatileParams {
+		query.Del(param)
+	}
+	u.RawQuery = query.Encode()
+	return fmt.Sprintf("%v %v", req.Method, u.String())
+}
+
+func fixtureFileName(dir string, req *http.Request) string {
+	hash := sha256.Sum256([]byte(fixtureKey(req)))
+	return filepath.Join(dir, fmt.Sprintf("%x.json", hash[:8]))
+}
+
+type recordTransport struct {
+	dir  string
+	next http.RoundTripper
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read response body for %v: %v", req.URL, err)
+	}
+	// Put the body back for whoever's actually using the response
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	data, err := json.MarshalIndent(&fixture{
+		Method: req.Method,
+		URL:    fixtureKey(req),
+		Status: resp.StatusCode,
+		Header: resp.Header,
+		Body:   string(body),
+	}, "", "\t")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal fixture for %v: %v", req.URL, err)
+	}
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return nil, fmt.Errorf("couldn't create fixture directory: %v", err)
+	}
+	if err := os.WriteFile(fixtureFileName(t.dir, req), data, 0644); err != nil {
+		return nil, fmt.Errorf("couldn't write fixture for %v: %v", req.URL, err)
+	}
+	return resp, nil
+}
+
+type replayTransport struct {
+	dir string
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	contents, err := os.ReadFile(fixtureFileName(t.dir, req))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no fixture recorded for %v (record it first)", fixtureKey(req))
+		}
+		return nil, fmt.Errorf("couldn't read fixture for %v: %v", req.URL, err)
+	}
+	f := fixture{}
+	if err := json.Unmarshal(contents, &f); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal fixture for %v: %v", req.URL, err)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%v %v", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.Header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(f.Body))),
+		ContentLength: int64(len(f.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Sends everything to the same host instead, like a mock API (see riottest)
+type redirectTransport struct {
+	base *url.URL
+	next http.RoundTripper
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers aren't supposed to modify the request
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.base.Scheme
+	req.URL.Host = t.base.Host
+	prefix := strings.TrimSuffix(t.base.Path, "/")
+	req.URL.Path = prefix + req.URL.Path
+	if req.URL.RawPath != "" {
+		req.URL.RawPath = prefix + req.URL.RawPath
+	}
+	req.Host = t.base.Host
+	return t.next.RoundTrip(req)
+}